@@ -4,5 +4,9 @@ go 1.15
 
 require (
 	github.com/bndr/gojenkins v1.0.1
+	github.com/hashicorp/go-uuid v1.0.1
 	github.com/hashicorp/terraform-plugin-sdk/v2 v2.4.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/net v0.0.0-20200707034311-ab3426394381
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
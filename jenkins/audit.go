@@ -0,0 +1,168 @@
+package jenkins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Version of the provider, set by main when built for a release
+var Version = "dev"
+
+type resourceAddressKey struct{}
+
+// withResourceAddress tags the scripts run with the context with the address of the resource running them
+func withResourceAddress(ctx context.Context, address string) context.Context {
+	return context.WithValue(ctx, resourceAddressKey{}, address)
+}
+
+// resourceAddress returns the address of the resource running the scripts, if any
+func resourceAddress(ctx context.Context) string {
+	address, _ := ctx.Value(resourceAddressKey{}).(string)
+	return address
+}
+
+// auditResource tags the operations of a resource or data source with its address. Terraform does
+// not hand the address of the configuration to providers, the type and ID of the resource are used.
+func auditResource(name string, r *schema.Resource) *schema.Resource {
+	address := func(id string) string {
+		if id == "" {
+			return name
+		}
+		return name + "." + id
+	}
+
+	type operation = func(context.Context, *schema.ResourceData, interface{}) diag.Diagnostics
+	wrap := func(f operation) operation {
+		if f == nil {
+			return nil
+		}
+		return func(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+			return f(withResourceAddress(ctx, address(d.Id())), d, m)
+		}
+	}
+	r.CreateContext = wrap(r.CreateContext)
+	r.ReadContext = wrap(r.ReadContext)
+	r.UpdateContext = wrap(r.UpdateContext)
+	r.DeleteContext = wrap(r.DeleteContext)
+
+	if customizeDiff := r.CustomizeDiff; customizeDiff != nil {
+		r.CustomizeDiff = func(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+			return customizeDiff(withResourceAddress(ctx, address(d.Id())), d, m)
+		}
+	}
+
+	return r
+}
+
+// scriptHeader is the comment opening every script, telling in the logs of Jenkins what sent it
+func (j *jenkinsAdapter) scriptHeader(ctx context.Context, script groovyScript) string {
+	header := fmt.Sprintf("// terraform-provider-jenkins version=%s run=%s script=%s", Version, j.runID, script.name)
+	if address := resourceAddress(ctx); address != "" {
+		header += " resource=" + address
+	}
+
+	// A line break would end the comment and run the rest of the header
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return '?'
+		}
+		return r
+	}, header) + "\n"
+}
+
+// auditEntry is a line of the audit log
+type auditEntry struct {
+	Time       string                 `json:"time"`
+	RunID      string                 `json:"run_id"`
+	Version    string                 `json:"provider_version"`
+	Resource   string                 `json:"resource,omitempty"`
+	Operation  string                 `json:"operation"`
+	Mutating   bool                   `json:"mutating"`
+	Params     map[string]interface{} `json:"params,omitempty"`
+	DurationMS int64                  `json:"duration_ms"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// auditLog appends a JSON line for every operation sent to Jenkins. Like the debug logs,
+// it holds the parameters of the scripts with their sensitive fields redacted.
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openAuditLog opens the audit log for appending, creating it readable by its owner only
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open the audit log: %v", err)
+	}
+	return &auditLog{file: file}, nil
+}
+
+func (a *auditLog) record(entry auditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err = a.file.Write(append(line, '\n'))
+	return err
+}
+
+// audit records an operation in the audit log, when enabled. The log is opened when the provider
+// is configured; failing to record an operation already made on Jenkins is only warned about,
+// the result of the operation itself is what Terraform must know.
+func (j *jenkinsAdapter) audit(ctx context.Context, operation string, mutating bool, data interface{}, start time.Time, opErr error) {
+	if j.auditLog == nil {
+		return
+	}
+
+	entry := auditEntry{
+		Time:       start.UTC().Format(time.RFC3339Nano),
+		RunID:      j.runID,
+		Version:    Version,
+		Resource:   resourceAddress(ctx),
+		Operation:  operation,
+		Mutating:   mutating,
+		Params:     auditParams(data),
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if opErr != nil {
+		entry.Error = opErr.Error()
+	}
+
+	if err := j.auditLog.record(entry); err != nil {
+		log.Printf("[WARN] Unable to record %s in the audit log: %v", operation, err)
+	}
+}
+
+// auditParams returns the parameters of the script, with its sensitive fields redacted
+func auditParams(data interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(data))
+	if value.Kind() != reflect.Struct {
+		return map[string]interface{}{"data": redacted}
+	}
+
+	params := map[string]interface{}{}
+	visitScriptParams(value, func(name string, value interface{}) {
+		params[name] = value
+	})
+	return params
+}
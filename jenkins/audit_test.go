@@ -0,0 +1,149 @@
+package jenkins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestScriptHeader(t *testing.T) {
+	var mu sync.Mutex
+	scripts := []string{}
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		scripts = append(scripts, r.FormValue("script"))
+		mu.Unlock()
+		w.Write([]byte(`{"error": false, "msg": "", "data": []}`))
+	})
+	client := newTestClient(t, server)
+
+	ctx := withResourceAddress(context.Background(), "jenkins_local_user.alice\nSystem.exit(1)")
+	if _, err := client.GetLocalUsers(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(scripts) != 1 {
+		t.Fatalf("Expected a single script, got %d", len(scripts))
+	}
+	header := strings.SplitN(scripts[0], "\n", 2)[0]
+	expected := "// terraform-provider-jenkins version=dev run=" + client.runID +
+		" script=get_local_users resource=jenkins_local_user.alice?System.exit(1)"
+	if header != expected {
+		t.Errorf("Expected the script header %q, got %q", expected, header)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.FormValue("script"), "createAccount") {
+			w.Write([]byte(`{"error": false, "msg": "", "data": {}}`))
+			return
+		}
+		w.Write([]byte(`{"error": true, "msg": "User bob not found", "data": {}}`))
+	})
+	client := newTestClient(t, server)
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.auditLog = auditLog
+
+	ctx := withResourceAddress(context.Background(), "jenkins_local_user.bob")
+	if err := client.CreateLocalUser(ctx, "bob", "s3cr3t", "Bob", "bob@example.com", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	client.DeleteLocalUser(ctx, "bob")
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "s3cr3t") {
+		t.Errorf("Expected the password to be redacted, got %s", content)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 operations recorded, got %d", len(lines))
+	}
+
+	entries := make([]auditEntry, len(lines))
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &entries[i]); err != nil {
+			t.Fatalf("Invalid audit log line %q: %v", line, err)
+		}
+		if entries[i].RunID != client.runID || entries[i].Resource != "jenkins_local_user.bob" || !entries[i].Mutating {
+			t.Errorf("Unexpected audit log entry: %+v", entries[i])
+		}
+	}
+
+	if entries[0].Operation != "create_local_user" || entries[0].Params["Password"] != redacted || entries[0].Params["Username"] != "bob" || entries[0].Error != "" {
+		t.Errorf("Unexpected audit log entry for the creation: %+v", entries[0])
+	}
+	if entries[1].Operation != "delete_local_user" || entries[1].Error != "" {
+		t.Errorf("Unexpected audit log entry for the deletion: %+v", entries[1])
+	}
+}
+
+func TestAuditLog_writeFailure(t *testing.T) {
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error": false, "msg": "", "data": {}}`))
+	})
+	client := newTestClient(t, server)
+
+	auditLog, err := openAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.auditLog = auditLog
+	auditLog.file.Close()
+
+	if err := client.CreateLocalUser(context.Background(), "bob", "s3cr3t", "Bob", "bob@example.com", ""); err != nil {
+		t.Errorf("Expected the result of the creation despite the audit log failure, got %v", err)
+	}
+}
+
+func TestAuditLog_jcasc(t *testing.T) {
+	stub := &jcascStub{}
+	client := &jcascClient{newTestClient(t, newJenkinsStub(t, stub.scriptConsole(t), stub.endpoints()...))}
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.auditLog = auditLog
+
+	if _, err := client.GetCurrentUsername(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := client.CreateLocalUser(context.Background(), "bob", "s3cr3t", "Bob", "bob@example.com", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	operations := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		entry := auditEntry{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Invalid audit log line %q: %v", line, err)
+		}
+		operations = append(operations, fmt.Sprintf("%s mutating=%t", entry.Operation, entry.Mutating))
+	}
+
+	expected := []string{"jcasc_current_user mutating=false", "jcasc_export mutating=false", "jcasc_apply mutating=true"}
+	if strings.Join(operations, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected the operations %v to be recorded, got %v", expected, operations)
+	}
+}
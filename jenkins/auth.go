@@ -0,0 +1,89 @@
+package jenkins
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// authRoundTripper authenticates the requests sent to the Jenkins server
+// with basic auth or a bearer token, and adds the configured headers.
+// The credentials come from the credential helper when there is one.
+type authRoundTripper struct {
+	base     http.RoundTripper
+	host     string
+	username string
+	password string
+	token    string
+	headers  map[string]string
+	helper   *credentialHelper
+}
+
+func (t *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Never leak credentials to another host, e.g. when following a redirect
+	if req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+
+	if t.helper == nil {
+		return t.base.RoundTrip(t.authenticate(req, t.username, t.password, t.token))
+	}
+
+	credentials, err := t.helper.get(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(t.authenticate(req, credentials.Username, credentials.secret(), credentials.Token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The credentials expired or were revoked. Jenkins did not run anything,
+	// the request is sent again with fresh credentials when its body can be replayed.
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	credentials, err = t.helper.refresh(req.Context(), credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.base.RoundTrip(t.authenticate(retry, credentials.Username, credentials.secret(), credentials.Token))
+}
+
+// authenticate returns a copy of the request with the headers and the credentials
+func (t *authRoundTripper) authenticate(req *http.Request, username string, password string, token string) *http.Request {
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case password != "":
+		req.SetBasicAuth(username, password)
+	}
+
+	return req
+}
+
+// readSecretFile reads a secret from a file, ignoring the trailing newline
+func readSecretFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read secret file %s: %v", path, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
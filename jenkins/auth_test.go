@@ -0,0 +1,74 @@
+package jenkins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestAuthRoundTripper(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	cases := []struct {
+		name          string
+		roundTripper  *authRoundTripper
+		authorization string
+	}{
+		{
+			name:          "basic",
+			roundTripper:  &authRoundTripper{username: "admin", password: "secret"},
+			authorization: "Basic YWRtaW46c2VjcmV0",
+		},
+		{
+			name:          "bearer",
+			roundTripper:  &authRoundTripper{token: "abc"},
+			authorization: "Bearer abc",
+		},
+	}
+
+	for _, c := range cases {
+		c.roundTripper.base = http.DefaultTransport
+		c.roundTripper.host = serverURL.Host
+		c.roundTripper.headers = map[string]string{"X-Custom": "value"}
+
+		client := &http.Client{Transport: c.roundTripper}
+		if _, err := client.Get(server.URL); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+
+		if got.Get("Authorization") != c.authorization {
+			t.Errorf("%s: expected Authorization %q, got %q", c.name, c.authorization, got.Get("Authorization"))
+		}
+		if got.Get("X-Custom") != "value" {
+			t.Errorf("%s: expected custom header to be sent, got %q", c.name, got.Get("X-Custom"))
+		}
+	}
+}
+
+func TestAuthRoundTripper_otherHost(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &authRoundTripper{
+		base:     http.DefaultTransport,
+		host:     "jenkins.example.com",
+		username: "admin",
+		password: "secret",
+	}}
+	if _, err := client.Get(server.URL); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got.Get("Authorization") != "" {
+		t.Errorf("Expected credentials not to be sent to another host")
+	}
+}
@@ -0,0 +1,185 @@
+package jenkins
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jenkinsScriptBatch is the data of the batch script. Only the names of the
+// batched scripts are logged, the scripts embed their parameters.
+type jenkinsScriptBatch struct {
+	Scripts []string
+	Payload string `redact:"true"`
+}
+
+// batchOperation is a script waiting in a batch for its output
+type batchOperation struct {
+	ctx     context.Context
+	script  groovyScript
+	data    interface{}
+	command string
+	done    chan batchResult
+}
+
+type batchResult struct {
+	output []byte
+	err    error
+}
+
+// scriptBatcher coalesces the scripts run within a short window into a single call
+// to the script console. Resources and data sources run their scripts as usual,
+// each caller waits for the output of its own operation.
+type scriptBatcher struct {
+	window  time.Duration
+	maxSize int
+	flush   func(ops []*batchOperation)
+
+	mu      sync.Mutex
+	pending []*batchOperation
+	timer   *time.Timer
+}
+
+// run queues the script in the next batch and waits for its output
+func (b *scriptBatcher) run(ctx context.Context, script groovyScript, data interface{}, command string) ([]byte, error) {
+	op := &batchOperation{ctx: ctx, script: script, data: data, command: command, done: make(chan batchResult, 1)}
+	logBatchedScript(script, data)
+
+	b.mu.Lock()
+	b.pending = append(b.pending, op)
+	if len(b.pending) >= b.maxSize {
+		b.flushPending()
+	} else if len(b.pending) == 1 {
+		b.timer = time.AfterFunc(b.window, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.flushPending()
+		})
+	}
+	b.mu.Unlock()
+
+	select {
+	case result := <-op.done:
+		return result.output, result.err
+	case <-ctx.Done():
+		b.cancel(op)
+		return nil, ctx.Err()
+	}
+}
+
+// flushPending sends the pending operations, it must be called with the lock held
+func (b *scriptBatcher) flushPending() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending) == 0 {
+		return
+	}
+
+	ops := b.pending
+	b.pending = nil
+	go b.flush(ops)
+}
+
+// cancel drops an operation that was not sent yet
+func (b *scriptBatcher) cancel(op *batchOperation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, pending := range b.pending {
+		if pending == op {
+			b.pending = append(b.pending[:i], b.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// runBatch runs the operations in a single script and hands each operation its own output.
+// The batch is only retried on failures that may have run it when all its operations are idempotent.
+func (j *jenkinsAdapter) runBatch(ops []*batchOperation) {
+	script := groovyScript{name: "batch", command: batchCommand, idempotent: true}
+	data := jenkinsScriptBatch{}
+	commands := make([]string, 0, len(ops))
+	resources := []string{}
+	seen := map[string]bool{}
+	for _, op := range ops {
+		script.idempotent = script.idempotent && op.script.idempotent
+		script.mutating = script.mutating || op.script.mutating
+		data.Scripts = append(data.Scripts, op.script.name)
+		commands = append(commands, op.command)
+		if resource := resourceAddress(op.ctx); resource != "" && !seen[resource] {
+			seen[resource] = true
+			resources = append(resources, resource)
+		}
+	}
+
+	payload, err := json.Marshal(commands)
+	if err != nil {
+		failBatch(ops, fmt.Errorf("Failed encoding script batch: %v", err))
+		return
+	}
+	data.Payload = base64.StdEncoding.EncodeToString(payload)
+
+	command, err := renderScript(script, data)
+	if err != nil {
+		failBatch(ops, err)
+		return
+	}
+
+	ctx, cancel := batchContext(ops, strings.Join(resources, ","))
+	defer cancel()
+	output, err := j.executeScript(ctx, script, data, command)
+	if err != nil {
+		failBatch(ops, err)
+		return
+	}
+
+	var outputs []struct {
+		Output    string `json:"output"`
+		Exception string `json:"exception"`
+	}
+	if err := json.Unmarshal(output, &outputs); err != nil {
+		failBatch(ops, fmt.Errorf("Unexpected response from Jenkins script batch: %v", err))
+		return
+	}
+	if len(outputs) != len(ops) {
+		failBatch(ops, fmt.Errorf("Unexpected response from Jenkins script batch: %d results for %d scripts", len(outputs), len(ops)))
+		return
+	}
+
+	for i, op := range ops {
+		if outputs[i].Exception != "" {
+			op.done <- batchResult{err: fmt.Errorf("Jenkins script %s failed: %s", op.script.name, outputs[i].Exception)}
+			continue
+		}
+		op.done <- batchResult{output: []byte(outputs[i].Output)}
+	}
+}
+
+// batchContext returns the context of a batch. The batch outlives the callers giving up on
+// their own operations, it is only cancelled once every caller waiting for it has given up.
+func batchContext(ops []*batchOperation, resources string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(withResourceAddress(context.Background(), resources))
+	go func() {
+		for _, op := range ops {
+			select {
+			case <-op.ctx.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+func failBatch(ops []*batchOperation, err error) {
+	for _, op := range ops {
+		op.done <- batchResult{err: err}
+	}
+}
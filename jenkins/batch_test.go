@@ -0,0 +1,195 @@
+package jenkins
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var stubBatchPayload = regexp.MustCompile(`'([A-Za-z0-9+/=]+)'\.decodeBase64\(\)`)
+
+// batchStub stands in for the batch script. Each batched script answers with its own
+// text as message, and scripts containing "fail" throw.
+type batchStub struct {
+	calls int32
+}
+
+func (s *batchStub) handle(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.calls, 1)
+
+	payload := stubBatchPayload.FindStringSubmatch(r.FormValue("script"))
+	if payload == nil {
+		http.Error(w, "unexpected script", http.StatusBadRequest)
+		return
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(payload[1])
+	var scripts []string
+	if err := json.Unmarshal(decoded, &scripts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results := []map[string]string{}
+	for _, script := range scripts {
+		if strings.Contains(script, "fail") {
+			results = append(results, map[string]string{"output": "", "exception": "java.lang.IllegalStateException: " + script})
+			continue
+		}
+		output, _ := json.Marshal(jenkinsResponse{Message: script})
+		results = append(results, map[string]string{"output": string(output) + "\n"})
+	}
+	json.NewEncoder(w).Encode(results)
+}
+
+func TestScriptBatcher_coalescesOperations(t *testing.T) {
+	stub := &batchStub{}
+	client := newTestClient(t, newJenkinsStub(t, stub.handle), withBatching(100*time.Millisecond, 50))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	messages := make([]string, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			script := fmt.Sprintf("println('%d')", i)
+			if i == 3 {
+				script = "fail()"
+			}
+			response := jenkinsResponse{}
+			errs[i] = client.PostScript(context.Background(), *bytes.NewBufferString(script), &response)
+			messages[i] = response.Message
+		}(i)
+	}
+	wg.Wait()
+
+	if stub.calls != 1 {
+		t.Errorf("Expected a single call to Jenkins, got %d", stub.calls)
+	}
+	for i := 0; i < 10; i++ {
+		if i == 3 {
+			if errs[i] == nil || !strings.Contains(errs[i].Error(), "IllegalStateException") {
+				t.Errorf("Expected the failed script to return its exception, got %v", errs[i])
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Errorf("Unexpected error of script %d: %v", i, errs[i])
+		}
+		if expected := fmt.Sprintf("println('%d')", i); messages[i] != expected {
+			t.Errorf("Expected script %d to get its own result %q, got %q", i, expected, messages[i])
+		}
+	}
+}
+
+func TestScriptBatcher_flushesFullBatch(t *testing.T) {
+	stub := &batchStub{}
+	client := newTestClient(t, newJenkinsStub(t, stub.handle), withBatching(time.Hour, 2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response := jenkinsResponse{}
+			if err := client.PostScript(context.Background(), *bytes.NewBufferString(fmt.Sprint(i)), &response); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if stub.calls != 2 {
+		t.Errorf("Expected 2 calls to Jenkins, got %d", stub.calls)
+	}
+}
+
+func TestScriptBatcher_cancelledOperationIsNotSent(t *testing.T) {
+	stub := &batchStub{}
+	client := newTestClient(t, newJenkinsStub(t, stub.handle), withBatching(50*time.Millisecond, 50))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	response := jenkinsResponse{}
+	if err := client.PostScript(ctx, *bytes.NewBufferString("println('')"), &response); err != context.Canceled {
+		t.Errorf("Expected the operation to be cancelled, got %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if stub.calls != 0 {
+		t.Errorf("Expected no call to Jenkins, got %d", stub.calls)
+	}
+}
+
+func TestScriptBatcher_cancelledOnceEveryCallerGaveUp(t *testing.T) {
+	stub := &batchStub{}
+	cancelled := make(chan bool, 1)
+	release := make(chan struct{})
+	client := newTestClient(t, newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		// The request is only seen cancelled once its body is read
+		r.ParseForm()
+		select {
+		case <-r.Context().Done():
+			cancelled <- true
+		case <-release:
+			cancelled <- false
+			stub.handle(w, r)
+		}
+	}), withBatching(time.Hour, 2))
+
+	for _, giveUp := range []int{1, 2} {
+		contexts := make([]context.Context, 2)
+		cancels := make([]context.CancelFunc, 2)
+		for i := range contexts {
+			contexts[i], cancels[i] = context.WithCancel(context.Background())
+			defer cancels[i]()
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i := range contexts {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				response := jenkinsResponse{}
+				errs[i] = client.PostScript(contexts[i], *bytes.NewBufferString(fmt.Sprintf("println('%d')", i)), &response)
+			}(i)
+		}
+
+		// Give the batch the time to be sent before the callers give up
+		time.Sleep(50 * time.Millisecond)
+		for i := 0; i < giveUp; i++ {
+			cancels[i]()
+		}
+		if giveUp < len(contexts) {
+			time.Sleep(50 * time.Millisecond)
+			release <- struct{}{}
+		}
+		wg.Wait()
+
+		select {
+		case requestCancelled := <-cancelled:
+			if requestCancelled != (giveUp == len(contexts)) {
+				t.Errorf("Expected the batch to be cancelled only once every caller gave up, got cancelled %t with %d callers giving up", requestCancelled, giveUp)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the batch to reach Jenkins with %d callers giving up", giveUp)
+		}
+		if errs[len(errs)-1] == nil && giveUp == len(contexts) {
+			t.Errorf("Expected the last caller to give up")
+		}
+		if errs[len(errs)-1] != nil && giveUp < len(contexts) {
+			t.Errorf("Expected the remaining caller to get its output, got %v", errs[len(errs)-1])
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// jenkinsCapabilities describes the Jenkins core version and the active plugins of the controller
+type jenkinsCapabilities struct {
+	Version string
+	Plugins map[string]string
+}
+
+// jenkinsRequirements are what a resource needs from the controller to work
+type jenkinsRequirements struct {
+	minVersion string
+	plugins    []string
+}
+
+// check returns an actionable error when the controller does not meet the requirements
+func (c jenkinsCapabilities) check(name string, r jenkinsRequirements) error {
+	var problems []string
+
+	if r.minVersion != "" && c.Version != "" && compareVersions(c.Version, r.minVersion) < 0 {
+		problems = append(problems, fmt.Sprintf("Jenkins %s or later is required, the controller runs %s", r.minVersion, c.Version))
+	}
+
+	var missing []string
+	for _, plugin := range r.plugins {
+		if _, ok := c.Plugins[plugin]; !ok {
+			missing = append(missing, plugin)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		problems = append(problems, fmt.Sprintf("the %s plugin(s) must be installed and enabled, from Manage Jenkins > Plugins", strings.Join(missing, ", ")))
+	}
+
+	if len(problems) > 0 {
+		code := codePreconditionFailed
+		if len(missing) > 0 {
+			code = codePluginMissing
+		}
+		return newJenkinsError(code, "%s cannot be used with this Jenkins controller: %s", name, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// compareVersions compares the numeric parts of two Jenkins versions, e.g. 2.263.1
+func compareVersions(a string, b string) int {
+	aParts := versionParts(a)
+	bParts := versionParts(b)
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aPart, bPart int
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+		if aPart != bPart {
+			if aPart < bPart {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(version string) []int {
+	// Ignore qualifiers, e.g. 2.263.1-SNAPSHOT or 2.263.1 (private build)
+	fields := strings.FieldsFunc(version, func(r rune) bool { return r == '-' || r == ' ' })
+	if len(fields) == 0 {
+		return nil
+	}
+
+	var parts []int
+	for _, part := range strings.Split(fields[0], ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		parts = append(parts, number)
+	}
+	return parts
+}
+
+// requireCapabilities fails planning of a resource when the controller does not meet its requirements
+func requireCapabilities(name string, r jenkinsRequirements) schema.CustomizeDiffFunc {
+	return func(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+		capabilities, err := m.(jenkinsClient).GetCapabilities(withPlanning(ctx))
+		if errors.Is(err, errProviderConfigUnknown) {
+			// Checked again once the provider configuration is known
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return capabilities.check(name, r)
+	}
+}
+
+// GetCapabilities discovers the core version and the active plugins once, then serves them from cache
+func (j *jenkinsAdapter) GetCapabilities(ctx context.Context) (jenkinsCapabilities, error) {
+	if err := j.connect(ctx); err != nil {
+		return jenkinsCapabilities{}, err
+	}
+
+	j.capabilitiesLock.Lock()
+	defer j.capabilitiesLock.Unlock()
+
+	if j.capabilities != nil {
+		return *j.capabilities, nil
+	}
+
+	capabilities, err := j.transport.fetchCapabilities(ctx)
+	if err != nil {
+		return jenkinsCapabilities{}, err
+	}
+
+	j.capabilities = &capabilities
+	return capabilities, nil
+}
@@ -0,0 +1,91 @@
+package jenkins
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"2.263.1", "2.160", 1},
+		{"2.160", "2.160", 0},
+		{"2.150.3", "2.160", -1},
+		{"2.160-SNAPSHOT (private-build)", "2.160", 0},
+		{"2.9", "2.10", -1},
+	}
+
+	for _, c := range cases {
+		if got := compareVersions(c.a, c.b); got != c.expected {
+			t.Errorf("Expected compareVersions(%q, %q) to be %d, got %d", c.a, c.b, c.expected, got)
+		}
+	}
+}
+
+func TestCapabilitiesCheck(t *testing.T) {
+	capabilities := jenkinsCapabilities{
+		Version: "2.150",
+		Plugins: map[string]string{"mailer": "1.32"},
+	}
+
+	if err := capabilities.check("jenkins_local_users", jenkinsRequirements{plugins: []string{"mailer"}}); err != nil {
+		t.Errorf("Expected requirements to be met, got %v", err)
+	}
+
+	err := capabilities.check("jenkins_local_user", jenkinsRequirements{minVersion: "2.160", plugins: []string{"mailer", "matrix-auth"}})
+	if err == nil {
+		t.Fatalf("Expected requirements not to be met")
+	}
+	for _, expected := range []string{"jenkins_local_user", "2.160", "2.150", "matrix-auth"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in error %q", expected, err)
+		}
+	}
+}
+
+func TestGetCapabilities(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/json":
+			w.Write([]byte(`{"mode": "NORMAL"}`))
+		case "/pluginManager/api/json":
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("X-Jenkins", "2.263.1")
+			w.Write([]byte(`{"plugins": [
+				{"shortName": "mailer", "version": "1.32", "active": true, "enabled": true},
+				{"shortName": "matrix-auth", "version": "2.6.4", "active": false, "enabled": false}
+			]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server)
+	for i := 0; i < 2; i++ {
+		capabilities, err := client.GetCapabilities(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if capabilities.Version != "2.263.1" {
+			t.Errorf("Expected version 2.263.1, got %s", capabilities.Version)
+		}
+		if _, ok := capabilities.Plugins["mailer"]; !ok {
+			t.Errorf("Expected mailer plugin to be active")
+		}
+		if _, ok := capabilities.Plugins["matrix-auth"]; ok {
+			t.Errorf("Expected disabled matrix-auth plugin to be ignored")
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected capabilities to be discovered once, got %d calls", calls)
+	}
+}
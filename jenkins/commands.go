@@ -1,5 +1,33 @@
 package jenkins
 
+// groovyScript is a groovy command run on the Jenkins script console
+type groovyScript struct {
+	// name identifies the script in the logs
+	name string
+	// command is the text/template rendering the groovy code
+	command string
+	// idempotent scripts are safe to run twice, so they are retried on any transient failure
+	idempotent bool
+	// mutating scripts change Jenkins, so they are rejected in read-only mode and audited as changes
+	mutating bool
+}
+
+var (
+	getLocalUserScript              = groovyScript{"get_local_user", getLocalUserCommand, true, false}
+	getLocalUsersScript             = groovyScript{"get_local_users", getLocalUsersCommand, true, false}
+	getCurrentUserScript            = groovyScript{"get_current_user", getCurrentUserCommand, true, false}
+	createLocalUserScript           = groovyScript{"create_local_user", createLocalUserCommand, false, true}
+	getLocalUserPropertiesScript    = groovyScript{"get_local_user_properties", getLocalUserPropertiesCommand, true, false}
+	updateLocalUserPropertiesScript = groovyScript{"update_local_user_properties", updateLocalUserPropertiesCommand, false, true}
+	renewLocalUserSeedScript        = groovyScript{"renew_local_user_seed", renewLocalUserSeedCommand, false, true}
+	deleteLocalUserScript           = groovyScript{"delete_local_user", deleteLocalUserCommand, false, true}
+	getGlobalMatrixScript           = groovyScript{"get_global_matrix", getGlobalMatrixCommand, true, false}
+	createUserPermissionsScript     = groovyScript{"create_user_permissions", createUserPermissionsCommand, false, true}
+	updateUserPermissionsScript     = groovyScript{"update_user_permissions", updateUserPermissionsCommand, false, true}
+	deleteUserPermissionsScript     = groovyScript{"delete_user_permissions", deleteUserPermissionsCommand, false, true}
+	getCapabilitiesScript           = groovyScript{"get_capabilities", getCapabilitiesCommand, true, false}
+)
+
 const getLocalUserCommand = `
 import hudson.security.HudsonPrivateSecurityRealm
 import hudson.security.HudsonPrivateSecurityRealm.Details
@@ -9,8 +37,9 @@ import groovy.json.JsonOutput
 def result = [:]
 
 def secRealm = jenkins.model.Jenkins.instance.getSecurityRealm()
-if (!secRealm instanceof HudsonPrivateSecurityRealm) {
+if (!(secRealm instanceof HudsonPrivateSecurityRealm)) {
   result['error'] = true
+  result['code'] = 'precondition_failed'
   result['msg'] = 'Jenkins is not using local user database'
   result['data'] = [:]
   return println(JsonOutput.toJson(result))
@@ -26,15 +55,68 @@ if (user != null) {
   	result['data']['password_hash'] = user.getProperty(Details.class).getPassword()
   	result['data']['email'] = user.getProperty(Mailer.UserProperty.class).getAddress()
   	result['data']['description'] = user.getDescription() != null ? user.getDescription() : ''
+  	result['data']['timezone'] = user.getProperty(hudson.model.TimeZoneProperty.class)?.getTimeZoneName() ?: ''
+  	result['data']['primary_view'] = user.getProperty(hudson.model.MyViewsProperty.class)?.getPrimaryViewName() ?: ''
+  	result['data']['ssh_public_keys'] = []
+  	try {
+  	  def sshKeysClass = jenkins.model.Jenkins.instance.pluginManager.uberClassLoader.loadClass('org.jenkinsci.main.modules.cli.auth.ssh.UserPropertyImpl')
+  	  def sshKeys = user.getProperty(sshKeysClass)?.authorizedKeys
+  	  if (sshKeys) {
+  	    result['data']['ssh_public_keys'] = sshKeys.readLines()*.trim().findAll { it }
+  	  }
+  	} catch (ClassNotFoundException e) {
+  	  // sshd module is not installed, the user cannot have SSH public keys
+  	}
 } else {
-	result['error'] = false
-  	result['msg'] = ''
+	result['error'] = true
+	result['code'] = 'not_found'
+  	result['msg'] = 'User {{ .Username }} does not exist'
   	result['data'] = [:]
 }
 
 return println(JsonOutput.toJson(result))
 `
 
+const getLocalUsersCommand = `
+import hudson.security.HudsonPrivateSecurityRealm
+import hudson.tasks.Mailer
+import groovy.json.JsonOutput
+
+def result = [:]
+
+def secRealm = jenkins.model.Jenkins.instance.getSecurityRealm()
+if (!(secRealm instanceof HudsonPrivateSecurityRealm)) {
+  result['error'] = true
+  result['code'] = 'precondition_failed'
+  result['msg'] = 'Jenkins is not using local user database'
+  result['data'] = []
+  return println(JsonOutput.toJson(result))
+}
+
+result['error'] = false
+result['msg'] = ''
+result['data'] = secRealm.getAllUsers().collect { user ->
+  def mailer = user.getProperty(Mailer.UserProperty.class)
+  [
+    username: user.getId(),
+    fullname: user.getFullName(),
+    email: mailer != null && mailer.getAddress() != null ? mailer.getAddress() : '',
+    description: user.getDescription() != null ? user.getDescription() : '',
+  ]
+}
+
+return println(JsonOutput.toJson(result))
+`
+
+const getCurrentUserCommand = `
+import groovy.json.JsonOutput
+
+def result = [error: false, msg: '', data: [:]]
+result['data']['username'] = jenkins.model.Jenkins.getAuthentication().getName()
+
+return println(JsonOutput.toJson(result))
+`
+
 const createLocalUserCommand = `
 import hudson.security.HudsonPrivateSecurityRealm
 import hudson.tasks.Mailer
@@ -42,8 +124,9 @@ import groovy.json.JsonOutput
 
 def result = [:]
 def secRealm = jenkins.model.Jenkins.instance.getSecurityRealm()
-if (!secRealm instanceof HudsonPrivateSecurityRealm) {
+if (!(secRealm instanceof HudsonPrivateSecurityRealm)) {
   result['error'] = true
+  result['code'] = 'precondition_failed'
   result['msg'] = 'Jenkins is not using local user database'
   result['data'] = [:]
   return println(JsonOutput.toJson(result))
@@ -60,20 +143,160 @@ result['data'] = [:]
 return println(JsonOutput.toJson(result))
 `
 
+const getLocalUserPropertiesCommand = `
+import hudson.security.HudsonPrivateSecurityRealm
+import groovy.json.JsonOutput
+
+def result = [:]
+def secRealm = jenkins.model.Jenkins.instance.getSecurityRealm()
+if (!(secRealm instanceof HudsonPrivateSecurityRealm)) {
+  result['error'] = true
+  result['code'] = 'precondition_failed'
+  result['msg'] = 'Jenkins is not using local user database'
+  result['data'] = []
+  return println(JsonOutput.toJson(result))
+}
+
+def user = secRealm.getUser('{{ .Username }}')
+if (user == null) {
+  result['error'] = true
+  result['code'] = 'not_found'
+  result['msg'] = 'User {{ .Username }} does not exist'
+  result['data'] = []
+  return println(JsonOutput.toJson(result))
+}
+
+def classLoader = jenkins.model.Jenkins.instance.pluginManager.uberClassLoader
+def describableModel = classLoader.loadClass('org.jenkinsci.plugins.structs.describable.DescribableModel')
+def propertyClasses = [{{range .Classes}}'{{.}}',{{end}}]
+result['error'] = false
+result['msg'] = ''
+result['data'] = propertyClasses.collect { className ->
+  def property = user.getProperty(classLoader.loadClass(className))
+  def arguments = [:]
+  if (property != null) {
+    describableModel.uninstantiate2_(property).getArguments().each { name, value ->
+      arguments[name] = value != null ? value.toString() : ''
+    }
+  }
+  [class: className, arguments: arguments]
+}
+
+return println(JsonOutput.toJson(result))
+`
+
+// updateLocalUserPropertiesCommand receives its parameters as base64 encoded JSON,
+// since SSH keys and generic property arguments can contain any character.
+const updateLocalUserPropertiesCommand = `
+import hudson.security.HudsonPrivateSecurityRealm
+import hudson.model.MyViewsProperty
+import hudson.model.TimeZoneProperty
+import groovy.json.JsonOutput
+import groovy.json.JsonSlurper
+
+def result = [:]
+def secRealm = jenkins.model.Jenkins.instance.getSecurityRealm()
+if (!(secRealm instanceof HudsonPrivateSecurityRealm)) {
+  result['error'] = true
+  result['code'] = 'precondition_failed'
+  result['msg'] = 'Jenkins is not using local user database'
+  result['data'] = [:]
+  return println(JsonOutput.toJson(result))
+}
+
+def params = new JsonSlurper().parseText(new String('{{ .Payload }}'.decodeBase64(), 'UTF-8'))
+def user = secRealm.getUser(params.username)
+if (user == null) {
+  result['error'] = true
+  result['code'] = 'not_found'
+  result['msg'] = "User ${params.username} does not exist"
+  result['data'] = [:]
+  return println(JsonOutput.toJson(result))
+}
+
+def classLoader = jenkins.model.Jenkins.instance.pluginManager.uberClassLoader
+
+// Only the attributes sent are changed, an empty value clears the attribute
+if (params.containsKey('timezone')) {
+  user.addProperty(new TimeZoneProperty(params.timezone ?: null))
+}
+
+if (params.containsKey('primary_view')) {
+  def views = user.getProperty(MyViewsProperty.class)
+  if (views == null) {
+    views = new MyViewsProperty()
+    user.addProperty(views)
+  }
+  views.setPrimaryViewName(params.primary_view ?: null)
+}
+
+if (params.containsKey('ssh_public_keys')) {
+  try {
+    def sshKeysClass = classLoader.loadClass('org.jenkinsci.main.modules.cli.auth.ssh.UserPropertyImpl')
+    user.addProperty(sshKeysClass.newInstance(params.ssh_public_keys.join('\n')))
+  } catch (ClassNotFoundException e) {
+    if (params.ssh_public_keys) {
+      result['error'] = true
+      result['code'] = 'plugin_missing'
+      result['msg'] = 'SSH public keys require the sshd plugin'
+      result['data'] = [:]
+      return println(JsonOutput.toJson(result))
+    }
+  }
+}
+
+if (params['properties'] || params['removed_properties']) {
+  def describableModel = classLoader.loadClass('org.jenkinsci.plugins.structs.describable.DescribableModel')
+  // A removed property is reset to the default a new user gets, users cannot hold no property of a kind
+  for (className in params['removed_properties']) {
+    def descriptor = jenkins.model.Jenkins.instance.getDescriptorOrDie(classLoader.loadClass(className))
+    def property = descriptor.newInstance(user)
+    if (property == null) {
+      result['error'] = true
+      result['code'] = 'precondition_failed'
+      result['msg'] = "User property ${className} has no default and cannot be removed"
+      result['data'] = [:]
+      return println(JsonOutput.toJson(result))
+    }
+    user.addProperty(property)
+  }
+  params['properties'].each { property ->
+    def clazz = classLoader.loadClass(property['class'])
+    user.addProperty(describableModel.newInstance(clazz).instantiate(property['arguments']))
+  }
+}
+
+user.save()
+result['error'] = false
+result['msg'] = "Properties of user ${params.username} successfully updated"
+result['data'] = [:]
+
+return println(JsonOutput.toJson(result))
+`
+
 const deleteLocalUserCommand = `
 import hudson.security.HudsonPrivateSecurityRealm
 import groovy.json.JsonOutput
 
 def result = [:]
 def secRealm = jenkins.model.Jenkins.instance.getSecurityRealm()
-if (!secRealm instanceof HudsonPrivateSecurityRealm) {
+if (!(secRealm instanceof HudsonPrivateSecurityRealm)) {
   result['error'] = true
+  result['code'] = 'precondition_failed'
   result['msg'] = 'Jenkins is not using local user database'
   result['data'] = [:]
   return println(JsonOutput.toJson(result))
 }
 
 user = secRealm.getUser('{{ .Username }}')
+if (user == null) {
+  result['error'] = true
+  result['code'] = 'not_found'
+  result['msg'] = 'User {{ .Username }} does not exist'
+  result['data'] = [:]
+  return println(JsonOutput.toJson(result))
+}
+
 user.delete()
 result['error'] = false
 result['msg'] = 'User {{ .Username }} successfully created'
@@ -82,7 +305,48 @@ result['data'] = [:]
 return println(JsonOutput.toJson(result))
 `
 
-const getUserPermissionsCommand = `
+const renewLocalUserSeedCommand = `
+import hudson.security.HudsonPrivateSecurityRealm
+import jenkins.security.seed.UserSeedProperty
+import groovy.json.JsonOutput
+
+def result = [:]
+def secRealm = jenkins.model.Jenkins.instance.getSecurityRealm()
+if (!(secRealm instanceof HudsonPrivateSecurityRealm)) {
+  result['error'] = true
+  result['code'] = 'precondition_failed'
+  result['msg'] = 'Jenkins is not using local user database'
+  result['data'] = [:]
+  return println(JsonOutput.toJson(result))
+}
+
+def user = secRealm.getUser('{{ .Username }}')
+if (user == null) {
+  result['error'] = true
+  result['code'] = 'not_found'
+  result['msg'] = 'User {{ .Username }} does not exist'
+  result['data'] = [:]
+  return println(JsonOutput.toJson(result))
+}
+
+def seed = user.getProperty(UserSeedProperty.class)
+if (seed == null || UserSeedProperty.DISABLE_USER_SEED) {
+  result['error'] = false
+  result['msg'] = 'User seed of {{ .Username }} not renewed, user seeds are disabled'
+  result['data'] = ['renewed': false]
+  return println(JsonOutput.toJson(result))
+}
+
+// Renewing the seed invalidates the sessions and remember me cookies of the user
+seed.renewSeed()
+result['error'] = false
+result['msg'] = 'User seed of {{ .Username }} successfully renewed'
+result['data'] = ['renewed': true]
+
+return println(JsonOutput.toJson(result))
+`
+
+const getGlobalMatrixCommand = `
 import hudson.security.Permission
 import groovy.json.JsonOutput
 
@@ -96,16 +360,19 @@ String shortName(Permission p) {
 }
 
 def strategy = Jenkins.instance.getAuthorizationStrategy()
-def permissions = []
 def result = [error: false, msg: '', data: [:]]
-result['data']['username'] = '{{ .Username }}'
-result['data']['permissions'] = []
-strategy.grantedPermissions.collect { permission, userList ->
-	userList.collect { user ->
-      if (user == '{{ .Username }}') {
-        result['data']['permissions'].push(shortName(permission))
-      }
-    }
+try {
+	def matrixClass = Jenkins.instance.pluginManager.uberClassLoader.loadClass('hudson.security.GlobalMatrixAuthorizationStrategy')
+	if (!matrixClass.isInstance(strategy)) {
+		return println(JsonOutput.toJson([error: true, code: 'precondition_failed', msg: 'Jenkins is not using the matrix authorization strategy', data: [:]]))
+	}
+} catch (ClassNotFoundException e) {
+	return println(JsonOutput.toJson([error: true, code: 'plugin_missing', msg: 'The matrix authorization strategy requires the matrix-auth plugin', data: [:]]))
+}
+strategy.grantedPermissions.each { permission, userList ->
+	userList.each { user ->
+		result['data'].get(user, []).push(shortName(permission))
+	}
 }
 println(JsonOutput.toJson(result))
 `
@@ -134,14 +401,30 @@ def permissionIds = Permission.all.findAll { permission ->
 
 def strategy = Jenkins.instance.getAuthorizationStrategy()
 def result = [error: false, msg: '', data: [:]]
+try {
+	def matrixClass = Jenkins.instance.pluginManager.uberClassLoader.loadClass('hudson.security.GlobalMatrixAuthorizationStrategy')
+	if (!matrixClass.isInstance(strategy)) {
+		return println(JsonOutput.toJson([error: true, code: 'precondition_failed', msg: 'Jenkins is not using the matrix authorization strategy', data: [:]]))
+	}
+} catch (ClassNotFoundException e) {
+	return println(JsonOutput.toJson([error: true, code: 'plugin_missing', msg: 'The matrix authorization strategy requires the matrix-auth plugin', data: [:]]))
+}
 def user_permissions = [{{range .Permissions}}'{{.}}',{{end}}]
 user_permissions.removeAll([null])
 
-user_permissions.collect {
-	strategy.add(permissionIds[it], '{{ .Username }}')
+def unknown = user_permissions.findAll { !permissionIds.containsKey(it) }
+if (unknown) {
+	return println(JsonOutput.toJson([error: true, code: 'precondition_failed', msg: "Unknown permissions ${unknown.join(', ')}, the plugins defining them may be missing", data: [:]]))
 }
 
-Jenkins.instance.save()
+// Concurrent changes of the strategy would lose grants
+synchronized (strategy) {
+	user_permissions.collect {
+		strategy.add(permissionIds[it], '{{ .Username }}')
+	}
+
+	Jenkins.instance.save()
+}
 result['msg'] = 'Permissions for user {{ .Username }} is created'
 
 println(JsonOutput.toJson(result))
@@ -171,20 +454,36 @@ def permissionIds = Permission.all.findAll { permission ->
 
 def strategy = Jenkins.instance.getAuthorizationStrategy()
 def result = [error: false, msg: '', data: [:]]
+try {
+	def matrixClass = Jenkins.instance.pluginManager.uberClassLoader.loadClass('hudson.security.GlobalMatrixAuthorizationStrategy')
+	if (!matrixClass.isInstance(strategy)) {
+		return println(JsonOutput.toJson([error: true, code: 'precondition_failed', msg: 'Jenkins is not using the matrix authorization strategy', data: [:]]))
+	}
+} catch (ClassNotFoundException e) {
+	return println(JsonOutput.toJson([error: true, code: 'plugin_missing', msg: 'The matrix authorization strategy requires the matrix-auth plugin', data: [:]]))
+}
 def user_permissions = [{{range .Permissions}}'{{.}}',{{end}}]
 user_permissions.removeAll([null])
 
-user_permissions.collect {
-	strategy.add(permissionIds[it], '{{ .Username }}')
+def unknown = user_permissions.findAll { !permissionIds.containsKey(it) }
+if (unknown) {
+	return println(JsonOutput.toJson([error: true, code: 'precondition_failed', msg: "Unknown permissions ${unknown.join(', ')}, the plugins defining them may be missing", data: [:]]))
 }
 
-strategy.grantedPermissions.collect { permission, userList ->
-	if (!user_permissions.contains(shortName(permission))) {
-		userList.remove('{{ .Username }}')
+// Concurrent changes of the strategy would lose grants
+synchronized (strategy) {
+	user_permissions.collect {
+		strategy.add(permissionIds[it], '{{ .Username }}')
 	}
-}
 
-Jenkins.instance.save()
+	strategy.grantedPermissions.collect { permission, userList ->
+		if (!user_permissions.contains(shortName(permission))) {
+			userList.remove('{{ .Username }}')
+		}
+	}
+
+	Jenkins.instance.save()
+}
 result['msg'] = 'Permissions of user {{ .Username }} is updated'
 
 println(JsonOutput.toJson(result))
@@ -195,11 +494,66 @@ import groovy.json.JsonOutput
 
 def strategy = Jenkins.instance.getAuthorizationStrategy()
 def result = [error: false, msg: '', data: [:]]
-strategy.grantedPermissions.collect { permission, userList ->
-	userList.remove('{{ .Username }}')
+try {
+	def matrixClass = Jenkins.instance.pluginManager.uberClassLoader.loadClass('hudson.security.GlobalMatrixAuthorizationStrategy')
+	if (!matrixClass.isInstance(strategy)) {
+		return println(JsonOutput.toJson([error: true, code: 'precondition_failed', msg: 'Jenkins is not using the matrix authorization strategy', data: [:]]))
+	}
+} catch (ClassNotFoundException e) {
+	return println(JsonOutput.toJson([error: true, code: 'plugin_missing', msg: 'The matrix authorization strategy requires the matrix-auth plugin', data: [:]]))
+}
+// Concurrent changes of the strategy would lose grants
+synchronized (strategy) {
+	strategy.grantedPermissions.collect { permission, userList ->
+		userList.remove('{{ .Username }}')
+	}
+	Jenkins.instance.save()
 }
-Jenkins.instance.save()
 result['msg'] = 'User {{ .Username }} has been removed from the global matrix authorization'
 
 println(JsonOutput.toJson(result))
 `
+
+// getCapabilitiesCommand discovers the core version and the active plugins
+// when the REST API is not reachable
+const getCapabilitiesCommand = `
+import groovy.json.JsonOutput
+
+def plugins = [:]
+Jenkins.instance.pluginManager.plugins.each { plugin ->
+  if (plugin.isActive() && plugin.isEnabled()) {
+    plugins[plugin.shortName] = plugin.version
+  }
+}
+
+println(JsonOutput.toJson([version: Jenkins.VERSION, plugins: plugins]))
+`
+
+// batchCommand runs several scripts in a single call. Each script is evaluated by its own shell,
+// with the default imports of the script console, and its output is captured separately so
+// every operation gets its own result.
+const batchCommand = `
+import groovy.json.JsonOutput
+import groovy.json.JsonSlurper
+import org.codehaus.groovy.control.CompilerConfiguration
+import org.codehaus.groovy.control.customizers.ImportCustomizer
+
+def scripts = new JsonSlurper().parseText(new String('{{ .Payload }}'.decodeBase64(), 'UTF-8'))
+def configuration = new CompilerConfiguration()
+configuration.addCompilationCustomizers(new ImportCustomizer().addStarImports('jenkins', 'jenkins.model', 'hudson', 'hudson.model'))
+
+def results = scripts.collect { script ->
+  def output = new StringWriter()
+  def out = new PrintWriter(output)
+  def shell = new GroovyShell(Jenkins.instance.pluginManager.uberClassLoader, new Binding([out: out]), configuration)
+  try {
+    shell.evaluate(script)
+    out.flush()
+    return [output: output.toString()]
+  } catch (Throwable e) {
+    out.flush()
+    return [output: output.toString(), exception: e.toString()]
+  }
+}
+println(JsonOutput.toJson(results))
+`
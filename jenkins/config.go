@@ -2,29 +2,41 @@ package jenkins
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
-	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	jenkins "github.com/bndr/gojenkins"
+	"github.com/hashicorp/go-uuid"
+	"golang.org/x/net/http/httpproxy"
 )
 
 type jenkinsClient interface {
-	GetLocalUser(username string) (jenkinsLocalUser, error)
-	CreateLocalUser(username string, password string, fullname string, email string, description string) error
-	DeleteLocalUser(username string) error
-	GetUserPermissions(username string) (jenkinsUserPermissions, error)
-	CreateUserPermissions(username string, permissions []string) error
-	UpdateUserPermissions(username string, permissions []string) error
-	DeleteUserPermissions(username string) error
-	PostScript(payload bytes.Buffer, respStruct interface{}) error
+	GetLocalUser(ctx context.Context, username string) (jenkinsLocalUser, error)
+	GetLocalUsers(ctx context.Context) ([]jenkinsLocalUser, error)
+	GetCurrentUsername(ctx context.Context) (string, error)
+	CreateLocalUser(ctx context.Context, username string, password string, fullname string, email string, description string) error
+	GetLocalUserProperties(ctx context.Context, username string, classes []string) ([]jenkinsUserProperty, error)
+	UpdateLocalUserProperties(ctx context.Context, properties jenkinsLocalUserProperties) error
+	RenewLocalUserSeed(ctx context.Context, username string) error
+	DeleteLocalUser(ctx context.Context, username string) error
+	GetUserPermissions(ctx context.Context, username string) (jenkinsUserPermissions, error)
+	CreateUserPermissions(ctx context.Context, username string, permissions []string) error
+	UpdateUserPermissions(ctx context.Context, username string, permissions []string) error
+	DeleteUserPermissions(ctx context.Context, username string) error
+	GetCapabilities(ctx context.Context) (jenkinsCapabilities, error)
+	PostScript(ctx context.Context, payload bytes.Buffer, respStruct interface{}) error
 }
 
 type jenkinsLocalUser struct {
@@ -33,26 +45,92 @@ type jenkinsLocalUser struct {
 	PasswordHash string `json:"password_hash"`
 	Username     string `json:"username"`
 	Description  string `json:"description"`
+
+	Timezone      string   `json:"timezone"`
+	PrimaryView   string   `json:"primary_view"`
+	SSHPublicKeys []string `json:"ssh_public_keys"`
 }
 
 type jenkinsLocalUserCreate struct {
-	Password string
+	Password string `redact:"true"`
 	jenkinsLocalUser
 }
 
+// jenkinsScriptPayload passes JSON encoded parameters to the scripts that need
+// more than plain strings
+type jenkinsScriptPayload struct {
+	Username string
+	Payload  string `redact:"true"`
+}
+
 type jenkinsResponse struct {
 	Error   bool             `json:"error"`
+	Code    string           `json:"code"`
 	Message string           `json:"msg"`
 	Data    jenkinsLocalUser `json:"data"`
 }
 
+type jenkinsResponseLocalUsers struct {
+	Error   bool               `json:"error"`
+	Code    string             `json:"code"`
+	Message string             `json:"msg"`
+	Data    []jenkinsLocalUser `json:"data"`
+}
+
+// jenkinsUserProperty is a user property described by its class and the arguments
+// of its data bound constructor and setters
+type jenkinsUserProperty struct {
+	Class     string            `json:"class"`
+	Arguments map[string]string `json:"arguments"`
+}
+
+type jenkinsUserPropertiesQuery struct {
+	Username string
+	Classes  []string
+}
+
+type jenkinsResponseUserProperties struct {
+	Error   bool                  `json:"error"`
+	Code    string                `json:"code"`
+	Message string                `json:"msg"`
+	Data    []jenkinsUserProperty `json:"data"`
+}
+
+// jenkinsLocalUserProperties are the properties to change. The attributes left nil
+// are not sent, so the script leaves them untouched.
+type jenkinsLocalUserProperties struct {
+	Username          string                `json:"username"`
+	Timezone          *string               `json:"timezone,omitempty"`
+	PrimaryView       *string               `json:"primary_view,omitempty"`
+	SSHPublicKeys     *[]string             `json:"ssh_public_keys,omitempty"`
+	Properties        []jenkinsUserProperty `json:"properties"`
+	RemovedProperties []string              `json:"removed_properties"`
+}
+
 type jenkinsUserPermissions struct {
 	Username    string   `json:"username"`
 	Permissions []string `json:"permissions"`
 }
 
+type jenkinsResponseUserSeed struct {
+	Error   bool   `json:"error"`
+	Code    string `json:"code"`
+	Message string `json:"msg"`
+	Data    struct {
+		Renewed bool `json:"renewed"`
+	} `json:"data"`
+}
+
+type jenkinsResponseGlobalMatrix struct {
+	Error   bool                `json:"error"`
+	Code    string              `json:"code"`
+	Message string              `json:"msg"`
+	Data    map[string][]string `json:"data"`
+}
+
 type jenkinsResponseUserPermissions struct {
 	Error   bool                   `json:"error"`
+	Code    string                 `json:"code"`
 	Message string                 `json:"msg"`
 	Data    jenkinsUserPermissions `json:"data"`
 }
@@ -60,72 +138,339 @@ type jenkinsResponseUserPermissions struct {
 // jenkinsAdapter wraps the Jenkins client, enabling additional functionality
 type jenkinsAdapter struct {
 	*jenkins.Jenkins
+	config    *Config
+	retry     retryPolicy
+	http      *httpTransport
+	transport scriptTransport
+
+	connected   bool
+	connectLock sync.Mutex
+
+	capabilities     *jenkinsCapabilities
+	capabilitiesLock sync.Mutex
+
+	locks keyedMutex
+
+	globalMatrix     map[string][]string
+	globalMatrixLock sync.Mutex
+
+	batcher *scriptBatcher
+
+	runID    string
+	auditLog *auditLog
 }
 
 // Config is the set of parameters needed to configure the Jenkins provider.
 type Config struct {
 	ServerURL string
-	CACert    io.Reader
+	CACert    string
 	Username  string
 	Password  string
+	APIToken  string
+	Token     string
+	Headers   map[string]string
 	VerifySSL bool
+
+	CredentialCommand []string
+
+	ClientCert    string
+	ClientKey     string
+	TLSMinVersion string
+	TLSServerName string
+
+	ProxyURL           string
+	NoProxy            []string
+	RequestTimeout     time.Duration
+	ConnectTimeout     time.Duration
+	MaxIdleConnections int
+
+	MaxRetries   int
+	RetryWaitMin time.Duration
+	RetryWaitMax time.Duration
+
+	BatchWindow  time.Duration
+	BatchMaxSize int
+
+	ReadOnly bool
+	AuditLog string
+
+	Transport     string
+	SSHAddress    string
+	SSHPrivateKey string
+	SSHHostKey    string
 }
 
-func newJenkinsClient(c *Config) *jenkinsAdapter {
-	rootCAs, _ := x509.SystemCertPool()
-	if rootCAs == nil {
-		rootCAs = x509.NewCertPool()
+// authModes returns the authentication modes configured
+func (c *Config) authModes() []string {
+	modes := []string{}
+	if c.Password != "" {
+		modes = append(modes, "password")
+	}
+	if c.APIToken != "" {
+		modes = append(modes, "api_token")
+	}
+	if c.Token != "" {
+		modes = append(modes, "token")
 	}
+	if len(c.CredentialCommand) > 0 {
+		modes = append(modes, "credential_command")
+	}
+	return modes
+}
 
-	if c.CACert != nil {
-		// provide CA certificate if server is using self-signed certificate
-		certs, err := ioutil.ReadAll(c.CACert)
-		if err != nil {
-			log.Fatal("Failed to read provided certificate file")
-		}
+// validate checks that exactly one authentication mode is configured
+func (c *Config) validate() error {
+	serverURL, err := url.Parse(c.ServerURL)
+	if err != nil || (serverURL.Scheme != "http" && serverURL.Scheme != "https") || serverURL.Host == "" {
+		return fmt.Errorf("server_url %q must be an absolute http or https URL", c.ServerURL)
+	}
+
+	modes := c.authModes()
+	switch {
+	case len(modes) == 0:
+		return fmt.Errorf("One of password, api_token, token or credential_command must be set to authenticate to Jenkins")
+	case len(modes) > 1:
+		return fmt.Errorf("Only one of password, api_token, token or credential_command can be set, got %s", strings.Join(modes, ", "))
+	case c.Token != "" && c.Username != "":
+		return fmt.Errorf("username cannot be used with a bearer token")
+	case (c.Password != "" || c.APIToken != "") && c.Username == "":
+		return fmt.Errorf("username must be set when authenticating with %s", modes[0])
+	}
 
-		if ok := rootCAs.AppendCertsFromPEM(certs); !ok {
-			log.Println("No certs appended, using system certs only")
+	for name := range c.Headers {
+		if strings.EqualFold(name, "Authorization") {
+			return fmt.Errorf("The Authorization header cannot be set in headers, use password, api_token or token instead")
 		}
 	}
 
+	return nil
+}
+
+func newJenkinsClient(c *Config) (*jenkinsAdapter, error) {
+	// provide CA certificates if server is using self-signed certificate
+	rootCAs, err := loadCACertificates(c.CACert)
+	if err != nil {
+		return nil, err
+	}
+
 	config := &tls.Config{
 		InsecureSkipVerify: !c.VerifySSL,
 		RootCAs:            rootCAs,
+		ServerName:         c.TLSServerName,
+	}
+
+	if c.TLSMinVersion != "" {
+		version, ok := tlsVersions[c.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported TLS version %s", c.TLSMinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if c.ClientCert != "" || c.ClientKey != "" {
+		keyPair, err := loadClientCertificate(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{keyPair}
+	}
+	dialer := &net.Dialer{
+		Timeout:   c.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	tr := &http.Transport{
+		Proxy:               newProxyFunc(c),
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     config,
+		TLSHandshakeTimeout: c.ConnectTimeout,
+		MaxIdleConns:        c.MaxIdleConnections,
+		MaxIdleConnsPerHost: c.MaxIdleConnections,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	// An API token is sent like a password, through basic auth
+	password := c.Password
+	if c.APIToken != "" {
+		password = c.APIToken
 	}
-	tr := &http.Transport{TLSClientConfig: config}
-	httpClient := &http.Client{Transport: tr}
 
-	client := jenkins.CreateJenkins(httpClient, c.ServerURL, c.Username, c.Password)
+	var host string
+	if serverURL, err := url.Parse(c.ServerURL); err == nil {
+		host = serverURL.Host
+	}
+
+	var helper *credentialHelper
+	if len(c.CredentialCommand) > 0 {
+		helper = &credentialHelper{command: c.CredentialCommand, username: c.Username, serverURL: c.ServerURL}
+	}
+
+	// The crumb is only valid with the session it was issued for
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{
+		Timeout:       c.RequestTimeout,
+		Jar:           jar,
+		CheckRedirect: checkRedirect,
+		Transport: &authRoundTripper{
+			base:     tr,
+			host:     host,
+			username: c.Username,
+			password: password,
+			token:    c.Token,
+			headers:  c.Headers,
+			helper:   helper,
+		},
+	}
+
+	client := jenkins.CreateJenkins(httpClient, c.ServerURL)
 
 	// return the Jenkins API client
-	return &jenkinsAdapter{Jenkins: client}
+	adapter := &jenkinsAdapter{
+		Jenkins: client,
+		config:  c,
+		retry: retryPolicy{
+			maxRetries: c.MaxRetries,
+			waitMin:    c.RetryWaitMin,
+			waitMax:    c.RetryWaitMax,
+		},
+		http: &httpTransport{Jenkins: client, config: c},
+	}
+	adapter.transport = adapter.http
+	if c.Transport == transportSSH {
+		adapter.transport = &sshTransport{config: c}
+	}
+
+	// The run ID correlates the scripts sent by a Terraform run in the logs of Jenkins and the audit log
+	adapter.runID, err = uuid.GenerateUUID()
+	if err != nil {
+		return nil, fmt.Errorf("Failed generating the run ID: %v", err)
+	}
+	if c.AuditLog != "" {
+		adapter.auditLog, err = openAuditLog(c.AuditLog)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.BatchWindow > 0 {
+		maxSize := c.BatchMaxSize
+		if maxSize < 1 {
+			maxSize = 1
+		}
+		adapter.batcher = &scriptBatcher{window: c.BatchWindow, maxSize: maxSize, flush: adapter.runBatch}
+	}
+
+	return adapter, nil
 }
 
-func (j *jenkinsAdapter) GetLocalUser(username string) (jenkinsLocalUser, error) {
-	var command bytes.Buffer
-	commandTemplate := template.Must(template.New("command").Parse(getLocalUserCommand))
+// errProviderConfigUnknown is returned by the checks made while planning with a provider configuration not known yet
+var errProviderConfigUnknown = errors.New("The Jenkins provider configuration is not known yet, server_url or ssh_address is unknown")
 
-	err := commandTemplate.Execute(&command, jenkinsLocalUser{Username: username})
-	if err != nil {
-		return jenkinsLocalUser{}, fmt.Errorf("Failed parsing groovy commands to get local user: %v", err)
+// errServerURLMissing is returned by the calls made without server_url once the provider configuration is known
+var errServerURLMissing = errors.New("server_url must be set, in the provider configuration, with the JENKINS_URL environment variable or in a profile")
+
+type planningKey struct{}
+
+// withPlanning marks the calls made while planning, when the provider configuration may not be known yet
+func withPlanning(ctx context.Context) context.Context {
+	return context.WithValue(ctx, planningKey{}, true)
+}
+
+// planning tells whether the calls made with the context are made while planning
+func planning(ctx context.Context) bool {
+	planning, _ := ctx.Value(planningKey{}).(bool)
+	return planning
+}
+
+// connect validates the configuration and connects to Jenkins, on first use only
+func (j *jenkinsAdapter) connect(ctx context.Context) error {
+	j.connectLock.Lock()
+	defer j.connectLock.Unlock()
+
+	if j.connected {
+		return nil
+	}
+
+	// Unknown values of the provider configuration are empty while planning, e.g. when server_url
+	// comes from a resource not created yet. Terraform only applies with a known configuration.
+	endpoint := j.config.ServerURL
+	if j.config.Transport == transportSSH {
+		endpoint = j.config.SSHAddress
+	}
+	if endpoint == "" && planning(ctx) {
+		return errProviderConfigUnknown
+	}
+
+	if err := j.transport.open(ctx); err != nil {
+		return err
+	}
+
+	j.connected = true
+	return nil
+}
+
+// newProxyFunc returns the proxy selection of the provider. The proxy environment
+// variables are used unless a proxy URL is given, the no proxy list always applies.
+func newProxyFunc(c *Config) func(*http.Request) (*url.URL, error) {
+	proxyConfig := httpproxy.FromEnvironment()
+	if c.ProxyURL != "" {
+		proxyConfig.HTTPProxy = c.ProxyURL
+		proxyConfig.HTTPSProxy = c.ProxyURL
 	}
+	if len(c.NoProxy) > 0 {
+		proxyConfig.NoProxy = strings.Join(c.NoProxy, ",")
+	}
+
+	proxyFunc := proxyConfig.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
 
+func (j *jenkinsAdapter) GetLocalUser(ctx context.Context, username string) (jenkinsLocalUser, error) {
 	response := jenkinsResponse{}
-	var respStruct interface{} = &response
+	if err := j.runScript(ctx, getLocalUserScript, jenkinsLocalUser{Username: username}, &response); err != nil {
+		return jenkinsLocalUser{}, err
+	}
 
-	j.PostScript(command, respStruct)
+	if response.Error {
+		return jenkinsLocalUser{}, &jenkinsError{code: response.Code, message: response.Message}
+	}
+
+	return response.Data, nil
+}
+
+func (j *jenkinsAdapter) GetLocalUsers(ctx context.Context) ([]jenkinsLocalUser, error) {
+	response := jenkinsResponseLocalUsers{}
+	if err := j.runScript(ctx, getLocalUsersScript, nil, &response); err != nil {
+		return nil, err
+	}
 
 	if response.Error {
-		return jenkinsLocalUser{}, fmt.Errorf(response.Message)
+		return nil, &jenkinsError{code: response.Code, message: response.Message}
 	}
 
 	return response.Data, nil
 }
 
-func (j *jenkinsAdapter) CreateLocalUser(username string, password string, fullname string, email string, description string) error {
-	var command bytes.Buffer
-	commandTemplate := template.Must(template.New("command").Parse(createLocalUserCommand))
+// GetCurrentUsername returns the ID of the user the provider is authenticated as
+func (j *jenkinsAdapter) GetCurrentUsername(ctx context.Context) (string, error) {
+	response := jenkinsResponse{}
+	if err := j.runScript(ctx, getCurrentUserScript, nil, &response); err != nil {
+		return "", err
+	}
+
+	if response.Error {
+		return "", &jenkinsError{code: response.Code, message: response.Message}
+	}
+
+	return response.Data.Username, nil
+}
+
+func (j *jenkinsAdapter) CreateLocalUser(ctx context.Context, username string, password string, fullname string, email string, description string) error {
 	data := jenkinsLocalUserCreate{
 		Password: password,
 		jenkinsLocalUser: jenkinsLocalUser{
@@ -136,135 +481,212 @@ func (j *jenkinsAdapter) CreateLocalUser(username string, password string, fulln
 		},
 	}
 
-	err := commandTemplate.Execute(&command, data)
-	if err != nil {
-		return fmt.Errorf("Failed parsing groovy commands to get local user: %v", err)
-	}
-
 	response := jenkinsResponse{}
-	var respStruct interface{} = &response
-	j.PostScript(command, respStruct)
+	if err := j.runScript(ctx, createLocalUserScript, data, &response); err != nil {
+		return err
+	}
 
 	if response.Error {
-		return fmt.Errorf(response.Message)
+		return &jenkinsError{code: response.Code, message: response.Message}
 	}
 
 	return nil
 }
 
-func (j *jenkinsAdapter) DeleteLocalUser(username string) error {
-	var command bytes.Buffer
-	commandTemplate := template.Must(template.New("command").Parse(deleteLocalUserCommand))
-	err := commandTemplate.Execute(&command, jenkinsLocalUser{Username: username})
+func (j *jenkinsAdapter) GetLocalUserProperties(ctx context.Context, username string, classes []string) ([]jenkinsUserProperty, error) {
+	response := jenkinsResponseUserProperties{}
+	if err := j.runScript(ctx, getLocalUserPropertiesScript, jenkinsUserPropertiesQuery{Username: username, Classes: classes}, &response); err != nil {
+		return nil, err
+	}
+
+	if response.Error {
+		return nil, &jenkinsError{code: response.Code, message: response.Message}
+	}
+
+	return response.Data, nil
+}
+
+func (j *jenkinsAdapter) UpdateLocalUserProperties(ctx context.Context, properties jenkinsLocalUserProperties) error {
+	payload, err := json.Marshal(properties)
 	if err != nil {
-		return fmt.Errorf("Failed parsing groovy commands to get local user: %v", err)
+		return fmt.Errorf("Failed encoding local user properties: %v", err)
 	}
 
-	response := jenkinsResponse{}
-	var respStruct interface{} = &response
+	data := jenkinsScriptPayload{
+		Username: properties.Username,
+		Payload:  base64.StdEncoding.EncodeToString(payload),
+	}
 
-	j.PostScript(command, respStruct)
+	response := jenkinsResponse{}
+	if err := j.runScript(ctx, updateLocalUserPropertiesScript, data, &response); err != nil {
+		return err
+	}
 
 	if response.Error {
-		return fmt.Errorf(response.Message)
+		return &jenkinsError{code: response.Code, message: response.Message}
 	}
 
 	return nil
 }
 
-func (j *jenkinsAdapter) GetUserPermissions(username string) (jenkinsUserPermissions, error) {
-	var command bytes.Buffer
+// errSeedNotRenewed is returned when the existing sessions of a local user cannot be ended,
+// so the resources can warn about it instead of failing
+var errSeedNotRenewed = errors.New("the existing sessions are kept")
 
-	commandTemplate := template.Must(template.New("command").Parse(getUserPermissionsCommand))
-	err := commandTemplate.Execute(&command, jenkinsUserPermissions{Username: username})
-	if err != nil {
-		return jenkinsUserPermissions{}, fmt.Errorf("Error parsing groovy commands to get user permissions: %v", err)
+// RenewLocalUserSeed ends the existing sessions of a local user. It returns errSeedNotRenewed
+// when user seeds are disabled, as the sessions cannot be ended then.
+func (j *jenkinsAdapter) RenewLocalUserSeed(ctx context.Context, username string) error {
+	response := jenkinsResponseUserSeed{}
+	if err := j.runScript(ctx, renewLocalUserSeedScript, jenkinsLocalUser{Username: username}, &response); err != nil {
+		return err
 	}
 
-	response := jenkinsResponseUserPermissions{}
-	var respStruct interface{} = &response
-
-	j.PostScript(command, respStruct)
 	if response.Error {
-		return jenkinsUserPermissions{}, fmt.Errorf(response.Message)
+		return &jenkinsError{code: response.Code, message: response.Message}
+	}
+	if !response.Data.Renewed {
+		return fmt.Errorf("%s, %w", response.Message, errSeedNotRenewed)
 	}
 
-	return response.Data, nil
+	return nil
 }
 
-func (j *jenkinsAdapter) CreateUserPermissions(username string, permissions []string) error {
-	var command bytes.Buffer
+func (j *jenkinsAdapter) DeleteLocalUser(ctx context.Context, username string) error {
+	response := jenkinsResponse{}
+	if err := j.runScript(ctx, deleteLocalUserScript, jenkinsLocalUser{Username: username}, &response); err != nil {
+		return err
+	}
 
-	commandTemplate := template.Must(template.New("command").Parse(createUserPermissionsCommand))
-	err := commandTemplate.Execute(&command, jenkinsUserPermissions{Username: username, Permissions: permissions})
-	if err != nil {
-		return fmt.Errorf("Error parsing groovy commands to create user permissions: %v", err)
+	if response.Error {
+		return &jenkinsError{code: response.Code, message: response.Message}
 	}
 
+	return nil
+}
+
+func (j *jenkinsAdapter) CreateUserPermissions(ctx context.Context, username string, permissions []string) error {
+	defer j.locks.lock(authorizationStrategyLock)()
+	defer j.invalidateGlobalMatrix()
+
 	response := jenkinsResponseUserPermissions{}
-	var respStruct interface{} = &response
+	if err := j.runScript(ctx, createUserPermissionsScript, jenkinsUserPermissions{Username: username, Permissions: permissions}, &response); err != nil {
+		return err
+	}
 
-	j.PostScript(command, respStruct)
 	if response.Error {
-		return fmt.Errorf(response.Message)
+		return &jenkinsError{code: response.Code, message: response.Message}
 	}
 
 	return nil
 }
 
-func (j *jenkinsAdapter) UpdateUserPermissions(username string, permissions []string) error {
-	var command bytes.Buffer
+func (j *jenkinsAdapter) UpdateUserPermissions(ctx context.Context, username string, permissions []string) error {
+	defer j.locks.lock(authorizationStrategyLock)()
+	defer j.invalidateGlobalMatrix()
 
-	commandTemplate := template.Must(template.New("command").Parse(updateUserPermissionsCommand))
-	err := commandTemplate.Execute(&command, jenkinsUserPermissions{Username: username, Permissions: permissions})
-	if err != nil {
-		return fmt.Errorf("Error parsing groovy commands to update user permissions: %v", err)
+	response := jenkinsResponseUserPermissions{}
+	if err := j.runScript(ctx, updateUserPermissionsScript, jenkinsUserPermissions{Username: username, Permissions: permissions}, &response); err != nil {
+		return err
 	}
 
+	if response.Error {
+		return &jenkinsError{code: response.Code, message: response.Message}
+	}
+
+	return nil
+}
+
+func (j *jenkinsAdapter) DeleteUserPermissions(ctx context.Context, username string) error {
+	defer j.locks.lock(authorizationStrategyLock)()
+	defer j.invalidateGlobalMatrix()
+
 	response := jenkinsResponseUserPermissions{}
-	var respStruct interface{} = &response
+	if err := j.runScript(ctx, deleteUserPermissionsScript, jenkinsUserPermissions{Username: username}, &response); err != nil {
+		return err
+	}
 
-	j.PostScript(command, respStruct)
 	if response.Error {
-		return fmt.Errorf(response.Message)
+		return &jenkinsError{code: response.Code, message: response.Message}
 	}
 
 	return nil
 }
 
-func (j *jenkinsAdapter) DeleteUserPermissions(username string) error {
+// runScript renders the groovy script with its data and runs it on Jenkins
+func (j *jenkinsAdapter) runScript(ctx context.Context, script groovyScript, data interface{}, respStruct interface{}) error {
+	command, err := renderScript(script, data)
+	if err != nil {
+		return err
+	}
+
+	return j.postScript(ctx, script, data, command, respStruct)
+}
+
+// renderScript executes the template of the groovy script with its data
+func renderScript(script groovyScript, data interface{}) (string, error) {
 	var command bytes.Buffer
+	commandTemplate := template.Must(template.New(script.name).Parse(script.command))
 
-	commandTemplate := template.Must(template.New("command").Parse(deleteUserPermissionsCommand))
-	err := commandTemplate.Execute(&command, jenkinsUserPermissions{Username: username})
-	if err != nil {
-		return fmt.Errorf("Error parsing groovy commands to delete user permissions: %v", err)
+	if err := commandTemplate.Execute(&command, data); err != nil {
+		return "", fmt.Errorf("Failed parsing groovy commands of %s: %v", script.name, err)
 	}
 
-	response := jenkinsResponseUserPermissions{}
-	var respStruct interface{} = &response
+	return command.String(), nil
+}
 
-	j.PostScript(command, respStruct)
-	if response.Error {
-		return fmt.Errorf(response.Message)
+// PostScript runs a groovy script on Jenkins and decodes its JSON output into respStruct.
+// The script is considered as mutating, so it is only retried when it did not run.
+func (j *jenkinsAdapter) PostScript(ctx context.Context, payload bytes.Buffer, respStruct interface{}) error {
+	return j.postScript(ctx, groovyScript{name: "script", mutating: true}, nil, payload.String(), respStruct)
+}
+
+// postScript runs the script on Jenkins, batched with other scripts when batching is enabled.
+// The script data is only used for logging, with its sensitive fields redacted.
+func (j *jenkinsAdapter) postScript(ctx context.Context, script groovyScript, data interface{}, command string, respStruct interface{}) error {
+	if j.config.ReadOnly && script.mutating {
+		return readOnlyError(fmt.Sprintf("Running script %s", script.name))
+	}
+
+	if err := j.connect(ctx); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	var output []byte
+	var err error
+	if j.batcher != nil {
+		output, err = j.batcher.run(ctx, script, data, command)
+	} else {
+		output, err = j.executeScript(ctx, script, data, command)
+	}
+	j.audit(ctx, script.name, script.mutating, data, start, err)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(output, respStruct); err != nil {
+		return fmt.Errorf("Unexpected response from Jenkins script %s: %v", script.name, err)
 	}
 
 	return nil
 }
 
-func (j *jenkinsAdapter) PostScript(payload bytes.Buffer, respStruct interface{}) error {
-	finalPayload := url.Values{}
-	finalPayload.Set("script", payload.String())
+// executeScript sends the script to Jenkins, retrying transient failures, and returns its output
+func (j *jenkinsAdapter) executeScript(ctx context.Context, script groovyScript, data interface{}, command string) ([]byte, error) {
+	command = j.scriptHeader(ctx, script) + command
 
-	fmt.Println(payload.String())
-	resp, err := j.Requester.Post("/scriptText", strings.NewReader(finalPayload.Encode()), respStruct, map[string]string{})
+	start := time.Now()
+	result, err := j.retry.retry(ctx, script.idempotent, func() (scriptResult, error) {
+		return j.transport.sendScript(ctx, command)
+	})
+	logScript(script, data, result, err, time.Since(start))
 	if err != nil {
-		return fmt.Errorf("Error making request to Jenkins: %v", err)
+		return nil, fmt.Errorf("Error making request to Jenkins: %v", err)
 	}
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("Call to jenkins return non 200 response code: %d, %v", resp.StatusCode, resp)
+	if result.statusCode != http.StatusOK {
+		return nil, statusCodeError(result.statusCode, "Call to jenkins return non 200 response code: %d", result.statusCode)
 	}
 
-	return nil
+	return result.body, nil
 }
@@ -1,20 +1,84 @@
 package jenkins
 
 import (
-	"bytes"
+	"net/http"
 	"testing"
 )
 
 func TestNewJenkinsClient(t *testing.T) {
-	c := newJenkinsClient(&Config{})
-	if c == nil {
+	c, err := newJenkinsClient(&Config{})
+	if err != nil || c == nil {
 		t.Errorf("Expected populated client")
 	}
 
-	c = newJenkinsClient(&Config{
-		CACert: bytes.NewBufferString("certificate"),
+	cert, _ := testCertificate(t, "jenkins")
+	c, err = newJenkinsClient(&Config{
+		CACert: cert,
 	})
-	if string(c.Requester.CACert) != "certificate" {
-		t.Errorf("Initialization did not extract certificate data")
+	if err != nil || c == nil {
+		t.Errorf("Expected populated client with certificate, got %v", err)
+	}
+
+	_, err = newJenkinsClient(&Config{
+		CACert: "-----BEGIN CERTIFICATE-----\ncertificate\n-----END CERTIFICATE-----",
+	})
+	if err == nil {
+		t.Errorf("Expected invalid certificate to fail")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := []Config{
+		{ServerURL: "https://jenkins.example.com", Username: "admin", Password: "secret"},
+		{ServerURL: "https://jenkins.example.com", Username: "admin", APIToken: "11aa"},
+		{ServerURL: "https://jenkins.example.com", Token: "bearer"},
+		{ServerURL: "http://localhost:8080/jenkins", Token: "bearer", Headers: map[string]string{"X-Forwarded-User": "admin"}},
+	}
+	for _, c := range valid {
+		if err := c.validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", c, err)
+		}
+	}
+
+	invalid := []Config{
+		{ServerURL: "jenkins.example.com", Username: "admin", Password: "secret"},
+		{ServerURL: "https://jenkins.example.com", Username: "admin"},
+		{ServerURL: "https://jenkins.example.com", Password: "secret"},
+		{ServerURL: "https://jenkins.example.com", Username: "admin", Password: "secret", APIToken: "11aa"},
+		{ServerURL: "https://jenkins.example.com", Username: "admin", Token: "bearer"},
+		{ServerURL: "https://jenkins.example.com", Token: "bearer", Headers: map[string]string{"authorization": "Basic"}},
+	}
+	for _, c := range invalid {
+		if err := c.validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", c)
+		}
+	}
+}
+
+func TestNewProxyFunc(t *testing.T) {
+	proxy := newProxyFunc(&Config{
+		ProxyURL: "http://proxy.example.com:3128",
+		NoProxy:  []string{"internal.example.com", "10.0.0.0/8"},
+	})
+
+	cases := map[string]string{
+		"https://jenkins.example.com/scriptText":    "http://proxy.example.com:3128",
+		"https://jenkins.internal.example.com/":     "",
+		"http://10.1.2.3:8080/crumbIssuer/api/json": "",
+	}
+	for target, expected := range cases {
+		req, _ := http.NewRequest("GET", target, nil)
+		proxyURL, err := proxy(req)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", target, err)
+		}
+
+		got := ""
+		if proxyURL != nil {
+			got = proxyURL.String()
+		}
+		if got != expected {
+			t.Errorf("Expected proxy %q for %s, got %q", expected, target, got)
+		}
 	}
 }
@@ -0,0 +1,112 @@
+package jenkins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// helperCredentials is the JSON output of the credential command, with the same
+// fields as the provider attributes
+type helperCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	APIToken string `json:"api_token"`
+	Token    string `json:"token"`
+}
+
+// secret returns the password or the API token, an API token is sent like a password
+func (c *helperCredentials) secret() string {
+	if c.APIToken != "" {
+		return c.APIToken
+	}
+	return c.Password
+}
+
+// credentialHelper runs the credential command on first use, then again once Jenkins
+// rejects the credentials, e.g. short-lived tokens from a broker
+type credentialHelper struct {
+	command   []string
+	username  string
+	serverURL string
+
+	mu      sync.Mutex
+	current *helperCredentials
+}
+
+// get returns the current credentials, running the command when there are none yet
+func (h *credentialHelper) get(ctx context.Context) (*helperCredentials, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.current == nil {
+		credentials, err := h.run(ctx)
+		if err != nil {
+			return nil, err
+		}
+		h.current = credentials
+	}
+	return h.current, nil
+}
+
+// refresh replaces the rejected credentials. Concurrent requests rejected with the
+// same credentials only run the command once.
+func (h *credentialHelper) refresh(ctx context.Context, rejected *helperCredentials) (*helperCredentials, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.current != rejected {
+		return h.current, nil
+	}
+
+	credentials, err := h.run(ctx)
+	if err != nil {
+		h.current = nil
+		return nil, err
+	}
+	h.current = credentials
+	return h.current, nil
+}
+
+// run executes the credential command, without shell. The command is told the
+// Jenkins URL through the JENKINS_URL environment variable.
+func (h *credentialHelper) run(ctx context.Context) (*helperCredentials, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.command[0], h.command[1:]...)
+	cmd.Env = append(os.Environ(), "JENKINS_URL="+h.serverURL)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("credential_command %s failed: %v: %s", h.command[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	credentials := &helperCredentials{}
+	if err := json.Unmarshal(stdout.Bytes(), credentials); err != nil {
+		// The output is not quoted, it holds secrets
+		return nil, fmt.Errorf("credential_command %s returned invalid JSON: %v", h.command[0], err)
+	}
+	if credentials.Username == "" {
+		credentials.Username = h.username
+	}
+
+	secrets := 0
+	for _, secret := range []string{credentials.Password, credentials.APIToken, credentials.Token} {
+		if secret != "" {
+			secrets++
+		}
+	}
+	switch {
+	case secrets != 1:
+		return nil, fmt.Errorf("credential_command %s must return exactly one of password, api_token or token", h.command[0])
+	case credentials.Token == "" && credentials.Username == "":
+		return nil, fmt.Errorf("credential_command %s must return a username with a password or an API token, or username must be set", h.command[0])
+	}
+
+	return credentials, nil
+}
@@ -0,0 +1,101 @@
+package jenkins
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestCredentialHelperProcess is the credential command of the tests. It prints the
+// token matching the number of times it ran, counted in a file.
+func TestCredentialHelperProcess(t *testing.T) {
+	counterFile := os.Getenv("JENKINS_TEST_CREDENTIAL_COUNTER")
+	if counterFile == "" {
+		return
+	}
+
+	content, _ := ioutil.ReadFile(counterFile)
+	runs, _ := strconv.Atoi(string(content))
+	runs++
+	ioutil.WriteFile(counterFile, []byte(strconv.Itoa(runs)), 0600)
+
+	if os.Getenv("JENKINS_URL") == "" {
+		fmt.Fprint(os.Stderr, "JENKINS_URL is not set")
+		os.Exit(1)
+	}
+	fmt.Printf(`{"token": "token-%d"}`, runs)
+	os.Exit(0)
+}
+
+func newCredentialHelperCommand(t *testing.T) ([]string, func() int) {
+	counterFile := filepath.Join(t.TempDir(), "runs")
+	os.Setenv("JENKINS_TEST_CREDENTIAL_COUNTER", counterFile)
+	t.Cleanup(func() { os.Unsetenv("JENKINS_TEST_CREDENTIAL_COUNTER") })
+
+	runs := func() int {
+		content, _ := ioutil.ReadFile(counterFile)
+		n, _ := strconv.Atoi(string(content))
+		return n
+	}
+	return []string{os.Args[0], "-test.run=^TestCredentialHelperProcess$"}, runs
+}
+
+func TestCredentialHelper_refreshesRejectedCredentials(t *testing.T) {
+	command, runs := newCredentialHelperCommand(t)
+
+	// Only the second token is accepted, the first one expired
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error": false, "msg": "", "data": {"username": "admin"}}`))
+	}, withStubProxy(func(jenkins http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token-2" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			jenkins.ServeHTTP(w, r)
+		})
+	}))
+	client := newTestClient(t, server, withCredentialCommand(command))
+
+	for i := 0; i < 3; i++ {
+		username, err := client.GetCurrentUsername(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if username != "admin" {
+			t.Errorf("Expected current user admin, got %s", username)
+		}
+	}
+
+	if runs() != 2 {
+		t.Errorf("Expected the credential command to run twice, got %d runs", runs())
+	}
+}
+
+func TestCredentialHelper_invalidOutput(t *testing.T) {
+	cases := map[string]string{
+		"failing command":      `echo "vault is sealed" >&2; exit 1`,
+		"invalid JSON":         `echo "s3cr3t"`,
+		"several secrets":      `echo '{"username": "admin", "password": "s3cr3t", "token": "t0k3n"}'`,
+		"username is required": `echo '{"password": "s3cr3t"}'`,
+	}
+
+	for name, script := range cases {
+		t.Run(name, func(t *testing.T) {
+			helper := &credentialHelper{command: []string{"sh", "-c", script}, serverURL: "https://jenkins.example.com"}
+			_, err := helper.get(context.Background())
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+			if strings.Contains(err.Error(), "s3cr3t") {
+				t.Errorf("Expected the secrets not to be part of the error, got %v", err)
+			}
+		})
+	}
+}
@@ -16,9 +16,18 @@ func dataSourceLocalUser() *schema.Resource {
 
 func dataSourceLocalUserRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	client := m.(jenkinsClient)
+
+	capabilities, err := client.GetCapabilities(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if err := capabilities.check("jenkins_local_user", jenkinsRequirements{plugins: []string{"mailer"}}); err != nil {
+		return diag.FromErr(err)
+	}
+
 	username := d.Get("username").(string)
 
-	user, err := client.GetLocalUser(username)
+	user, err := client.GetLocalUser(ctx, username)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -43,6 +52,18 @@ func dataSourceLocalUserRead(ctx context.Context, d *schema.ResourceData, m inte
 		return diag.FromErr(err)
 	}
 
+	if err := d.Set("timezone", user.Timezone); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set("primary_view", user.PrimaryView); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set("ssh_public_keys", user.SSHPublicKeys); err != nil {
+		return diag.FromErr(err)
+	}
+
 	d.SetId(username)
 	return nil
 }
@@ -73,4 +94,22 @@ var dataSourceLocalUserSchema = map[string]*schema.Schema{
 		Computed:    true,
 		Description: "Description of the Jenkins local user",
 	},
+	"timezone": {
+		Type:        schema.TypeString,
+		Computed:    true,
+		Description: "Time zone of the Jenkins local user",
+	},
+	"primary_view": {
+		Type:        schema.TypeString,
+		Computed:    true,
+		Description: "Name of the default view of the Jenkins local user",
+	},
+	"ssh_public_keys": {
+		Type:        schema.TypeList,
+		Computed:    true,
+		Description: "SSH public keys of the Jenkins local user",
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	},
 }
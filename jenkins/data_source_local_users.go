@@ -0,0 +1,142 @@
+package jenkins
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	localUsersManagedAll      = "all"
+	localUsersManagedOnly     = "managed"
+	localUsersManagedExcluded = "unmanaged"
+)
+
+func dataSourceLocalUsers() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceLocalUsersRead,
+		Schema:      dataSourceLocalUsersSchema,
+	}
+}
+
+func dataSourceLocalUsersRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(jenkinsClient)
+
+	capabilities, err := client.GetCapabilities(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if err := capabilities.check("jenkins_local_users", jenkinsRequirements{plugins: []string{"mailer"}}); err != nil {
+		return diag.FromErr(err)
+	}
+
+	var usernameRegex, emailRegex *regexp.Regexp
+	if v, ok := d.GetOk("username_regex"); ok {
+		usernameRegex = regexp.MustCompile(v.(string))
+	}
+	if v, ok := d.GetOk("email_regex"); ok {
+		emailRegex = regexp.MustCompile(v.(string))
+	}
+	managed := d.Get("managed").(string)
+
+	users, err := client.GetLocalUsers(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	result := make([]interface{}, 0, len(users))
+	usernames := make([]string, 0, len(users))
+	for _, user := range users {
+		if usernameRegex != nil && !usernameRegex.MatchString(user.Username) {
+			continue
+		}
+		if emailRegex != nil && !emailRegex.MatchString(user.Email) {
+			continue
+		}
+
+		isManaged := strings.EqualFold(strings.TrimSpace(user.Description), managedByTerraformDescription)
+		if managed == localUsersManagedOnly && !isManaged {
+			continue
+		}
+		if managed == localUsersManagedExcluded && isManaged {
+			continue
+		}
+
+		result = append(result, map[string]interface{}{
+			"username":    user.Username,
+			"fullname":    user.Fullname,
+			"email":       user.Email,
+			"description": user.Description,
+		})
+		usernames = append(usernames, user.Username)
+	}
+
+	if err := d.Set("users", result); err != nil {
+		return diag.FromErr(err)
+	}
+
+	hash := sha1.Sum([]byte(strings.Join(usernames, ",")))
+	d.SetId(hex.EncodeToString(hash[:]))
+	return nil
+}
+
+var dataSourceLocalUsersSchema = map[string]*schema.Schema{
+	"username_regex": {
+		Type:         schema.TypeString,
+		Optional:     true,
+		ValidateFunc: validation.StringIsValidRegExp,
+		Description:  "Regular expression the username of the Jenkins local users must match",
+	},
+	"email_regex": {
+		Type:         schema.TypeString,
+		Optional:     true,
+		ValidateFunc: validation.StringIsValidRegExp,
+		Description:  "Regular expression the email address of the Jenkins local users must match",
+	},
+	"managed": {
+		Type:     schema.TypeString,
+		Optional: true,
+		Default:  localUsersManagedAll,
+		ValidateFunc: validation.StringInSlice([]string{
+			localUsersManagedAll,
+			localUsersManagedOnly,
+			localUsersManagedExcluded,
+		}, false),
+		Description: "Filter on the Managed by Terraform description marker: all, managed or unmanaged",
+	},
+	"users": {
+		Type:        schema.TypeList,
+		Computed:    true,
+		Description: "Jenkins local users matching the filters",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"username": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "Username of the Jenkins local user",
+				},
+				"fullname": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "Full name of the Jenkins local user",
+				},
+				"email": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "Email address of the Jenkins local user",
+				},
+				"description": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "Description of the Jenkins local user",
+				},
+			},
+		},
+	},
+}
@@ -0,0 +1,70 @@
+package jenkins
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestAccLocalUsersDataSource_basic(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+				data "jenkins_local_users" "admins" {
+					username_regex = "^admin$"
+				}`,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.jenkins_local_users.admins", "users.#", "1"),
+					resource.TestCheckResourceAttr("data.jenkins_local_users.admins", "users.0.username", "admin"),
+					resource.TestCheckResourceAttr("data.jenkins_local_users.admins", "users.0.fullname", "admin"),
+				),
+			},
+			{
+				Config: `
+				data "jenkins_local_users" "managed" {
+					managed = "managed"
+				}`,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.jenkins_local_users.managed", "users.#", "0"),
+				),
+			},
+		},
+	})
+}
+
+func TestDataSourceLocalUsersRead_managed(t *testing.T) {
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error": false, "msg": "", "data": [
+			{"username": "alice", "description": "Managed by Terraform"},
+			{"username": "bob", "description": "managed by terraform "},
+			{"username": "carol", "description": "Created by hand"}
+		]}`))
+	})
+	client := newTestClient(t, server)
+
+	expected := map[string][]string{
+		localUsersManagedOnly:     {"alice", "bob"},
+		localUsersManagedExcluded: {"carol"},
+	}
+	for managed, usernames := range expected {
+		d := schema.TestResourceDataRaw(t, dataSourceLocalUsers().Schema, map[string]interface{}{"managed": managed})
+		if diags := dataSourceLocalUsersRead(context.Background(), d, client); diags.HasError() {
+			t.Fatalf("Unexpected error: %v", diags)
+		}
+
+		actual := []string{}
+		for _, user := range d.Get("users").([]interface{}) {
+			actual = append(actual, user.(map[string]interface{})["username"].(string))
+		}
+		if !reflect.DeepEqual(actual, usernames) {
+			t.Errorf("Expected %s users %v, got %v", managed, usernames, actual)
+		}
+	}
+}
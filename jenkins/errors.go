@@ -0,0 +1,64 @@
+package jenkins
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error codes returned by the scripts in the code field of their response, next to error and msg
+const (
+	codeNotFound           = "not_found"
+	codeConflict           = "conflict"
+	codePreconditionFailed = "precondition_failed"
+	codePluginMissing      = "plugin_missing"
+	codeForbidden          = "forbidden"
+)
+
+// The errors matching the error codes with errors.Is
+var (
+	errNotFound           = errors.New("not found")
+	errConflict           = errors.New("conflict")
+	errPreconditionFailed = errors.New("precondition failed")
+	errPluginMissing      = errors.New("plugin missing")
+	errForbidden          = errors.New("forbidden")
+)
+
+var errorCodes = map[string]error{
+	codeNotFound:           errNotFound,
+	codeConflict:           errConflict,
+	codePreconditionFailed: errPreconditionFailed,
+	codePluginMissing:      errPluginMissing,
+	codeForbidden:          errForbidden,
+}
+
+// jenkinsError is an error reported by Jenkins with its code. Scripts without a code,
+// or with an unknown one, report errors matching none of the coded errors.
+type jenkinsError struct {
+	code    string
+	message string
+}
+
+func newJenkinsError(code string, format string, args ...interface{}) error {
+	return &jenkinsError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func (e *jenkinsError) Error() string {
+	return e.message
+}
+
+func (e *jenkinsError) Unwrap() error {
+	return errorCodes[e.code]
+}
+
+// statusCodeError returns the error of an unexpected response status from Jenkins
+func statusCodeError(statusCode int, format string, args ...interface{}) error {
+	message := fmt.Sprintf(format, args...)
+	switch statusCode {
+	case http.StatusForbidden:
+		return &jenkinsError{code: codeForbidden, message: message}
+	case http.StatusConflict:
+		return &jenkinsError{code: codeConflict, message: message}
+	}
+	return errors.New(message)
+}
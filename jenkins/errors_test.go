@@ -0,0 +1,84 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestScriptErrorCodes(t *testing.T) {
+	cases := []struct {
+		response string
+		expected error
+	}{
+		{`{"error": true, "code": "not_found", "msg": "User bob does not exist", "data": {}}`, errNotFound},
+		{`{"error": true, "code": "conflict", "msg": "User bob was changed meanwhile", "data": {}}`, errConflict},
+		{`{"error": true, "code": "precondition_failed", "msg": "Jenkins is not using local user database", "data": {}}`, errPreconditionFailed},
+		{`{"error": true, "code": "plugin_missing", "msg": "SSH public keys require the sshd plugin", "data": {}}`, errPluginMissing},
+		{`{"error": true, "code": "forbidden", "msg": "Overall/Administer is required", "data": {}}`, errForbidden},
+		{`{"error": true, "msg": "Something went wrong", "data": {}}`, nil},
+	}
+
+	for _, c := range cases {
+		server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(c.response))
+		})
+		client := newTestClient(t, server)
+
+		_, err := client.GetLocalUser(context.Background(), "bob")
+		if err == nil {
+			t.Fatalf("Expected an error for %s", c.response)
+		}
+		for _, codeErr := range errorCodes {
+			if errors.Is(err, codeErr) != (codeErr == c.expected) {
+				t.Errorf("Unexpected match of %v with %v", err, codeErr)
+			}
+		}
+	}
+}
+
+func TestScriptErrorCodes_forbidden(t *testing.T) {
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+	client := newTestClient(t, server)
+
+	if _, err := client.GetLocalUsers(context.Background()); !errors.Is(err, errForbidden) {
+		t.Errorf("Expected a forbidden error, got %v", err)
+	}
+}
+
+func TestScriptErrorCodes_pluginMissing(t *testing.T) {
+	capabilities := jenkinsCapabilities{Version: "2.263.1", Plugins: map[string]string{}}
+
+	if err := capabilities.check("jenkins_local_user", jenkinsRequirements{plugins: []string{"mailer"}}); !errors.Is(err, errPluginMissing) {
+		t.Errorf("Expected a plugin missing error, got %v", err)
+	}
+	if err := capabilities.check("jenkins_local_user", jenkinsRequirements{minVersion: "2.300"}); !errors.Is(err, errPreconditionFailed) {
+		t.Errorf("Expected a precondition failed error, got %v", err)
+	}
+}
+
+func TestResourceLocalUserRead_notFound(t *testing.T) {
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error": true, "code": "not_found", "msg": "User bob does not exist", "data": {}}`))
+	})
+	client := newTestClient(t, server)
+
+	d := schema.TestResourceDataRaw(t, resourceLocalUser().Schema, map[string]interface{}{"username": "bob"})
+	d.SetId("bob")
+
+	if diags := resourceLocalUserRead(context.Background(), d, client); diags.HasError() {
+		t.Fatalf("Unexpected error: %v", diags)
+	}
+	if d.Id() != "" {
+		t.Errorf("Expected a deleted user to be removed from state")
+	}
+
+	if diags := resourceLocalUserDelete(context.Background(), d, client); diags.HasError() {
+		t.Errorf("Expected deleting a deleted user to succeed, got %v", diags)
+	}
+}
@@ -0,0 +1,436 @@
+package jenkins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// securityRealmLock serializes the changes to the security realm through configuration as code,
+// since each change exports the realm then applies it back
+const securityRealmLock = "security_realm"
+
+// errScriptAccessRequired is returned by the jcasc transport for the operations
+// configuration as code cannot express
+var errScriptAccessRequired = errors.New("requires access to the Jenkins script console, set transport to \"script\"")
+
+// jcascRequirements are the requirements of the jcasc transport
+var jcascRequirements = jenkinsRequirements{plugins: []string{"configuration-as-code"}}
+
+func scriptAccessRequired(operation string) error {
+	return fmt.Errorf("%s is not supported by configuration as code and %w", operation, errScriptAccessRequired)
+}
+
+// usesJCasC tells whether the client manages Jenkins through configuration as code,
+// so the operations it cannot express are reported while planning
+func usesJCasC(client jenkinsClient) bool {
+	if readOnly, ok := client.(readOnlyClient); ok {
+		client = readOnly.jenkinsClient
+	}
+	_, ok := client.(*jcascClient)
+	return ok
+}
+
+// jcascClient manages Jenkins through the endpoints of the configuration-as-code plugin,
+// for the controllers with a disabled script console. Changes export the current
+// configuration, then apply the modified part back.
+type jcascClient struct {
+	*jenkinsAdapter
+}
+
+func (c *jcascClient) GetLocalUser(ctx context.Context, username string) (jenkinsLocalUser, error) {
+	users, err := c.GetLocalUsers(ctx)
+	if err != nil {
+		return jenkinsLocalUser{}, err
+	}
+
+	// Like the default ID strategy, user IDs are case-insensitive
+	for _, user := range users {
+		if strings.EqualFold(user.Username, username) {
+			return user, nil
+		}
+	}
+
+	return jenkinsLocalUser{}, newJenkinsError(codeNotFound, "User %s does not exist", username)
+}
+
+func (c *jcascClient) GetLocalUsers(ctx context.Context) ([]jenkinsLocalUser, error) {
+	doc, err := c.export(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	realm, err := jcascLocalRealm(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []jenkinsLocalUser{}
+	for _, v := range jcascList(realm["users"]) {
+		entry := jcascMap(v)
+		user := jenkinsLocalUser{
+			Username:    jcascString(entry["id"]),
+			Fullname:    jcascString(entry["name"]),
+			Description: jcascString(entry["description"]),
+		}
+		for _, property := range jcascList(entry["properties"]) {
+			property := jcascMap(property)
+			if mailer := jcascMap(property["mailer"]); mailer != nil {
+				user.Email = jcascString(mailer["emailAddress"])
+			}
+			if timezone := jcascMap(property["timezone"]); timezone != nil {
+				user.Timezone = jcascString(timezone["timeZoneName"])
+			}
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// GetCurrentUsername asks the REST API, which remains available with the script console disabled
+func (c *jcascClient) GetCurrentUsername(ctx context.Context) (string, error) {
+	start := time.Now()
+	body, err := c.call(ctx, http.MethodGet, "/me/api/json", nil)
+	c.audit(ctx, "jcasc_current_user", false, nil, start, err)
+	if err != nil {
+		return "", err
+	}
+
+	me := struct {
+		ID string `json:"id"`
+	}{}
+	if err := json.Unmarshal(body, &me); err != nil {
+		return "", fmt.Errorf("Unexpected response from Jenkins current user: %v", err)
+	}
+
+	return me.ID, nil
+}
+
+// CreateLocalUser creates or updates the local user. Configuration as code hashes the password.
+func (c *jcascClient) CreateLocalUser(ctx context.Context, username string, password string, fullname string, email string, description string) error {
+	defer c.locks.lock(securityRealmLock)()
+
+	doc, err := c.export(ctx)
+	if err != nil {
+		return err
+	}
+
+	realm, err := jcascLocalRealm(doc)
+	if err != nil {
+		return err
+	}
+
+	// Users missing from the applied realm are left untouched, only the managed one is sent
+	local := map[string]interface{}{}
+	for key, value := range realm {
+		if key != "users" {
+			local[key] = value
+		}
+	}
+
+	user := map[string]interface{}{
+		"id":       escapeJCasC(username),
+		"password": escapeJCasC(password),
+		"properties": []interface{}{
+			map[string]interface{}{"mailer": map[string]interface{}{"emailAddress": escapeJCasC(email)}},
+		},
+	}
+	if fullname != "" {
+		user["name"] = escapeJCasC(fullname)
+	}
+	if description != "" {
+		user["description"] = escapeJCasC(description)
+	}
+	local["users"] = []interface{}{user}
+
+	return c.apply(ctx, map[string]interface{}{
+		"jenkins": map[string]interface{}{
+			"securityRealm": map[string]interface{}{"local": local},
+		},
+	})
+}
+
+func (c *jcascClient) GetLocalUserProperties(ctx context.Context, username string, classes []string) ([]jenkinsUserProperty, error) {
+	return nil, scriptAccessRequired("Reading the property blocks of local users")
+}
+
+// UpdateLocalUserProperties only succeeds when there is no property to change
+func (c *jcascClient) UpdateLocalUserProperties(ctx context.Context, properties jenkinsLocalUserProperties) error {
+	if properties.Timezone == nil && properties.PrimaryView == nil && properties.SSHPublicKeys == nil &&
+		len(properties.Properties) == 0 && len(properties.RemovedProperties) == 0 {
+		return nil
+	}
+
+	return scriptAccessRequired(fmt.Sprintf("Setting timezone, primary_view, ssh_public_keys or property blocks of local user %s", properties.Username))
+}
+
+// RenewLocalUserSeed does nothing but warn, the sessions cannot be ended without script access
+func (c *jcascClient) RenewLocalUserSeed(ctx context.Context, username string) error {
+	return fmt.Errorf("User seed of %s not renewed, renewing it requires script access, %w", username, errSeedNotRenewed)
+}
+
+func (c *jcascClient) DeleteLocalUser(ctx context.Context, username string) error {
+	return scriptAccessRequired(fmt.Sprintf("Deleting local user %s", username))
+}
+
+func (c *jcascClient) GetUserPermissions(ctx context.Context, username string) (jenkinsUserPermissions, error) {
+	return c.cachedUserPermissions(ctx, username, c.exportGlobalMatrix)
+}
+
+func (c *jcascClient) CreateUserPermissions(ctx context.Context, username string, permissions []string) error {
+	return c.setUserPermissions(ctx, username, permissions)
+}
+
+func (c *jcascClient) UpdateUserPermissions(ctx context.Context, username string, permissions []string) error {
+	return c.setUserPermissions(ctx, username, permissions)
+}
+
+func (c *jcascClient) DeleteUserPermissions(ctx context.Context, username string) error {
+	return c.setUserPermissions(ctx, username, nil)
+}
+
+func (c *jcascClient) PostScript(ctx context.Context, payload bytes.Buffer, respStruct interface{}) error {
+	return scriptAccessRequired("Running a groovy script")
+}
+
+// exportGlobalMatrix returns the permissions granted to every user in the global matrix
+func (c *jcascClient) exportGlobalMatrix(ctx context.Context) (map[string][]string, error) {
+	doc, err := c.export(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, matrix, err := jcascGlobalMatrix(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	granted := map[string][]string{}
+	for _, v := range jcascList(matrix["permissions"]) {
+		if permission, sid, ok := parseJCasCPermission(jcascString(v)); ok {
+			granted[sid] = append(granted[sid], permission)
+		}
+	}
+
+	return granted, nil
+}
+
+// setUserPermissions replaces the permissions granted to the user in the global matrix,
+// keeping the grants of the other users and groups
+func (c *jcascClient) setUserPermissions(ctx context.Context, username string, permissions []string) error {
+	defer c.locks.lock(authorizationStrategyLock)()
+	defer c.invalidateGlobalMatrix()
+
+	doc, err := c.export(ctx)
+	if err != nil {
+		return err
+	}
+
+	key, matrix, err := jcascGlobalMatrix(doc)
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	entries := []interface{}{}
+	for _, v := range jcascList(matrix["permissions"]) {
+		entry := jcascString(v)
+		if strings.HasPrefix(entry, "USER:") || strings.HasPrefix(entry, "GROUP:") {
+			prefix = "USER:"
+		}
+		if _, sid, ok := parseJCasCPermission(entry); ok && sid == username {
+			continue
+		}
+		entries = append(entries, escapeJCasC(entry))
+	}
+	for _, permission := range permissions {
+		entries = append(entries, escapeJCasC(prefix+permission+":"+username))
+	}
+
+	strategy := map[string]interface{}{}
+	for attribute, value := range matrix {
+		strategy[attribute] = value
+	}
+	strategy["permissions"] = entries
+
+	return c.apply(ctx, map[string]interface{}{
+		"jenkins": map[string]interface{}{
+			"authorizationStrategy": map[string]interface{}{key: strategy},
+		},
+	})
+}
+
+// export returns the current configuration of Jenkins
+func (c *jcascClient) export(ctx context.Context) (map[string]interface{}, error) {
+	start := time.Now()
+	body, err := c.call(ctx, http.MethodPost, "/configuration-as-code/export", nil)
+	c.audit(ctx, "jcasc_export", false, nil, start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("Unexpected configuration exported by Jenkins: %v", err)
+	}
+
+	return doc, nil
+}
+
+// apply configures Jenkins with the given configuration. The attributes missing
+// from the configuration are left untouched.
+func (c *jcascClient) apply(ctx context.Context, doc map[string]interface{}) error {
+	if c.config.ReadOnly {
+		return readOnlyError("Applying configuration as code")
+	}
+
+	body, err := yaml.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("Failed encoding configuration as code: %v", err)
+	}
+
+	start := time.Now()
+	_, err = c.call(ctx, http.MethodPost, "/configuration-as-code/apply", body)
+	c.audit(ctx, "jcasc_apply", true, nil, start, err)
+	return err
+}
+
+// call makes a request to Jenkins, retrying transient failures. Exports and applies are
+// safe to repeat, so they are retried like the idempotent scripts. Neither the request
+// nor the response body is logged or reported since they may hold passwords.
+func (c *jcascClient) call(ctx context.Context, method string, path string, body []byte) ([]byte, error) {
+	if err := c.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	capabilities, err := c.GetCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := capabilities.check("transport \"jcasc\"", jcascRequirements); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	result, err := c.retry.retry(ctx, true, func() (scriptResult, error) {
+		var resp *http.Response
+		var err error
+		if method == http.MethodPost {
+			contentType := ""
+			if body != nil {
+				contentType = "text/yaml"
+			}
+			resp, err = c.http.post(ctx, path, contentType, body)
+		} else {
+			var req *http.Request
+			req, err = http.NewRequestWithContext(ctx, method, c.Requester.Base+path, bytes.NewReader(body))
+			if err != nil {
+				return scriptResult{}, err
+			}
+			resp, err = c.Requester.Client.Do(req)
+		}
+		if err != nil {
+			return scriptResult{}, err
+		}
+		defer resp.Body.Close()
+
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return scriptResult{}, err
+		}
+
+		return scriptResult{statusCode: resp.StatusCode, body: respBody}, nil
+	})
+	log.Printf("[DEBUG] Jenkins configuration as code call: %s %s duration=%s status=%d",
+		method, path, time.Since(start).Round(time.Millisecond), result.statusCode)
+	if err != nil {
+		return nil, fmt.Errorf("Error making request to Jenkins: %v", err)
+	}
+
+	if result.statusCode != http.StatusOK {
+		return nil, statusCodeError(result.statusCode, "Call to jenkins %s return non 200 response code: %d", path, result.statusCode)
+	}
+
+	return result.body, nil
+}
+
+// jcascLocalRealm returns the attributes of the local user database in the exported configuration
+func jcascLocalRealm(doc map[string]interface{}) (map[string]interface{}, error) {
+	realm := jcascMap(jcascMap(doc["jenkins"])["securityRealm"])
+	local, ok := realm["local"]
+	if !ok {
+		return nil, newJenkinsError(codePreconditionFailed, "Jenkins is not using local user database")
+	}
+
+	if attributes := jcascMap(local); attributes != nil {
+		return attributes, nil
+	}
+	return map[string]interface{}{}, nil
+}
+
+// jcascGlobalMatrix returns the key and the attributes of the matrix authorization strategy
+// in the exported configuration
+func jcascGlobalMatrix(doc map[string]interface{}) (string, map[string]interface{}, error) {
+	strategy := jcascMap(jcascMap(doc["jenkins"])["authorizationStrategy"])
+	for _, key := range []string{"globalMatrix", "projectMatrix"} {
+		if attributes, ok := strategy[key]; ok {
+			matrix := jcascMap(attributes)
+			if matrix == nil {
+				matrix = map[string]interface{}{}
+			}
+			if _, ok := matrix["entries"]; ok {
+				return "", nil, fmt.Errorf("The entries format of the matrix authorization strategy is not supported by configuration as code, use transport \"script\"")
+			}
+			return key, matrix, nil
+		}
+	}
+
+	return "", nil, newJenkinsError(codePreconditionFailed, "Jenkins is not using the matrix authorization strategy")
+}
+
+// parseJCasCPermission splits a matrix entry like "Overall/Read:alice" or "USER:Overall/Read:alice".
+// Group entries are skipped.
+func parseJCasCPermission(entry string) (string, string, bool) {
+	if strings.HasPrefix(entry, "GROUP:") {
+		return "", "", false
+	}
+	entry = strings.TrimPrefix(entry, "USER:")
+
+	parts := strings.SplitN(entry, ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// escapeJCasC escapes the variable references configuration as code would resolve
+func escapeJCasC(value string) string {
+	return strings.ReplaceAll(value, "${", "^${")
+}
+
+func jcascMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func jcascList(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+func jcascString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,285 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"gopkg.in/yaml.v3"
+)
+
+const jcascStubExport = `
+jenkins:
+  securityRealm:
+    local:
+      allowsSignup: false
+      users:
+      - id: "admin"
+        name: "Administrator"
+        properties:
+        - "apiToken"
+        - mailer:
+            emailAddress: "admin@example.com"
+      - id: "alice"
+        properties:
+        - mailer:
+            emailAddress: "alice@example.com"
+  authorizationStrategy:
+    globalMatrix:
+      permissions:
+      - "Overall/Administer:admin"
+      - "Overall/Read:alice"
+      - "Job/Build:alice"
+`
+
+// jcascStub stands in for the configuration-as-code plugin, with the script console disabled
+type jcascStub struct {
+	mu      sync.Mutex
+	exports int
+	applied []map[string]interface{}
+	// rejected makes the applies fail, echoing the configuration like Jenkins does on invalid ones
+	rejected bool
+}
+
+// endpoints serves the current user and the configuration-as-code plugin
+func (s *jcascStub) endpoints() []jenkinsStubOption {
+	return []jenkinsStubOption{
+		withStubEndpoint("/me/api/json", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"id": "admin"}`))
+		}),
+		withStubEndpoint("/configuration-as-code/export", func(w http.ResponseWriter, r *http.Request) {
+			s.mu.Lock()
+			s.exports++
+			s.mu.Unlock()
+			w.Write([]byte(jcascStubExport))
+		}),
+		withStubEndpoint("/configuration-as-code/apply", func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			if s.rejected {
+				http.Error(w, "Invalid configuration: "+string(body), http.StatusBadRequest)
+				return
+			}
+			doc := map[string]interface{}{}
+			if err := yaml.Unmarshal(body, &doc); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.mu.Lock()
+			s.applied = append(s.applied, doc)
+			s.mu.Unlock()
+		}),
+	}
+}
+
+// scriptConsole fails the test on any script, the jcasc transport sends none
+func (s *jcascStub) scriptConsole(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected script sent with the jcasc transport")
+		http.Error(w, "script console disabled", http.StatusForbidden)
+	}
+}
+
+func TestJCasCClient_localUsers(t *testing.T) {
+	stub := &jcascStub{}
+	client := &jcascClient{newTestClient(t, newJenkinsStub(t, stub.scriptConsole(t), stub.endpoints()...))}
+
+	users, err := client.GetLocalUsers(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []jenkinsLocalUser{
+		{Username: "admin", Fullname: "Administrator", Email: "admin@example.com"},
+		{Username: "alice", Email: "alice@example.com"},
+	}
+	if !reflect.DeepEqual(users, expected) {
+		t.Errorf("Expected users %v, got %v", expected, users)
+	}
+
+	user, err := client.GetLocalUser(context.Background(), "ALICE")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if user.Username != "alice" {
+		t.Errorf("Expected user IDs to be case-insensitive, got %v", user)
+	}
+
+	username, err := client.GetCurrentUsername(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if username != "admin" {
+		t.Errorf("Expected current user admin, got %s", username)
+	}
+}
+
+func TestJCasCClient_createLocalUser(t *testing.T) {
+	stub := &jcascStub{}
+	client := &jcascClient{newTestClient(t, newJenkinsStub(t, stub.scriptConsole(t), stub.endpoints()...))}
+
+	if err := client.CreateLocalUser(context.Background(), "bob", "pa${ss}", "Bob", "bob@example.com", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(stub.applied) != 1 {
+		t.Fatalf("Expected a single configuration to be applied, got %d", len(stub.applied))
+	}
+	local := jcascMap(jcascMap(jcascMap(stub.applied[0]["jenkins"])["securityRealm"])["local"])
+	if local["allowsSignup"] != false {
+		t.Errorf("Expected the realm attributes to be kept, got %v", local)
+	}
+	users := jcascList(local["users"])
+	if len(users) != 1 {
+		t.Fatalf("Expected only the managed user to be applied, got %v", users)
+	}
+	user := jcascMap(users[0])
+	if user["id"] != "bob" || user["name"] != "Bob" {
+		t.Errorf("Unexpected user applied: %v", user)
+	}
+	if user["password"] != "pa^${ss}" {
+		t.Errorf("Expected variable references to be escaped, got %v", user["password"])
+	}
+}
+
+func TestJCasCClient_rejectedApply(t *testing.T) {
+	stub := &jcascStub{rejected: true}
+	client := &jcascClient{newTestClient(t, newJenkinsStub(t, stub.scriptConsole(t), stub.endpoints()...))}
+
+	err := client.CreateLocalUser(context.Background(), "bob", "bobpwd", "Bob", "bob@example.com", "")
+	if err == nil {
+		t.Fatalf("Expected the rejected configuration to fail")
+	}
+	if strings.Contains(err.Error(), "bobpwd") {
+		t.Errorf("Expected the password not to be reported, got %v", err)
+	}
+}
+
+func TestJCasCClient_userPermissions(t *testing.T) {
+	stub := &jcascStub{}
+	client := &jcascClient{newTestClient(t, newJenkinsStub(t, stub.scriptConsole(t), stub.endpoints()...))}
+
+	userPermissions, err := client.GetUserPermissions(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"Overall/Read", "Job/Build"}; !reflect.DeepEqual(userPermissions.Permissions, expected) {
+		t.Errorf("Expected permissions %v, got %v", expected, userPermissions.Permissions)
+	}
+
+	if err := client.UpdateUserPermissions(context.Background(), "alice", []string{"Overall/Read"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	matrix := jcascMap(jcascMap(jcascMap(stub.applied[0]["jenkins"])["authorizationStrategy"])["globalMatrix"])
+	expected := []interface{}{"Overall/Administer:admin", "Overall/Read:alice"}
+	if !reflect.DeepEqual(matrix["permissions"], expected) {
+		t.Errorf("Expected permissions %v to be applied, got %v", expected, matrix["permissions"])
+	}
+
+	if _, err := client.GetUserPermissions(context.Background(), "alice"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stub.exports != 3 {
+		t.Errorf("Expected the global matrix to be exported again after a change, got %d exports", stub.exports)
+	}
+}
+
+func TestJCasCClient_scriptAccessRequired(t *testing.T) {
+	stub := &jcascStub{}
+	client := &jcascClient{newTestClient(t, newJenkinsStub(t, stub.scriptConsole(t), stub.endpoints()...))}
+
+	if err := client.DeleteLocalUser(context.Background(), "alice"); !errors.Is(err, errScriptAccessRequired) {
+		t.Errorf("Expected deleting a user to require script access, got %v", err)
+	}
+	if err := client.RenewLocalUserSeed(context.Background(), "alice"); !errors.Is(err, errSeedNotRenewed) {
+		t.Errorf("Expected the seed not to be renewed without script access, got %v", err)
+	}
+	if err := client.UpdateLocalUserProperties(context.Background(), jenkinsLocalUserProperties{Username: "alice"}); err != nil {
+		t.Errorf("Expected no error without property to change, got %v", err)
+	}
+	timezone := "UTC"
+	if err := client.UpdateLocalUserProperties(context.Background(), jenkinsLocalUserProperties{Username: "alice", Timezone: &timezone}); !errors.Is(err, errScriptAccessRequired) {
+		t.Errorf("Expected setting properties to require script access, got %v", err)
+	}
+}
+
+func TestJCasCClient_planLocalUser(t *testing.T) {
+	stub := &jcascStub{}
+	client := &jcascClient{newTestClient(t, newJenkinsStub(t, stub.scriptConsole(t), stub.endpoints()...))}
+
+	state := map[string]string{
+		"username":          "alice",
+		"password":          "alicepwd",
+		"email":             "alice@example.com",
+		"fullname":          "Alice",
+		"description":       managedByTerraformDescription,
+		"ssh_public_keys.#": "0",
+		"property.#":        "0",
+	}
+	cases := []struct {
+		state    map[string]string
+		config   map[string]interface{}
+		rejected bool
+	}{
+		{nil, map[string]interface{}{"username": "bob"}, false},
+		{nil, map[string]interface{}{"username": "bob", "timezone": "UTC"}, true},
+		{state, map[string]interface{}{"password": "newalicepwd"}, false},
+		{state, map[string]interface{}{"rotate_seed": "1"}, true},
+		{state, map[string]interface{}{"primary_view": "builds"}, true},
+		{state, map[string]interface{}{"username": "bob"}, true},
+	}
+
+	for _, c := range cases {
+		err := testLocalUserPlan(t, c.state, testLocalUserConfig(c.config), client)
+		if errors.Is(err, errScriptAccessRequired) != c.rejected {
+			t.Errorf("Expected planning %v rejected %t, got %v", c.config, c.rejected, err)
+		}
+	}
+}
+
+func TestJCasCClient_updateLocalUser(t *testing.T) {
+	stub := &jcascStub{}
+	client := &jcascClient{newTestClient(t, newJenkinsStub(t, stub.scriptConsole(t), stub.endpoints()...))}
+
+	state := map[string]string{
+		"username":          "alice",
+		"password":          "alicepwd",
+		"email":             "alice@example.com",
+		"fullname":          "Alice",
+		"description":       managedByTerraformDescription,
+		"ssh_public_keys.#": "0",
+		"property.#":        "0",
+	}
+	d := testLocalUserData(t, state, testLocalUserConfig(map[string]interface{}{"password": "newalicepwd"}))
+	diags := resourceLocalUserUpdate(context.Background(), d, client)
+	if diags.HasError() || len(diags) != 1 || diags[0].Severity != diag.Warning {
+		t.Fatalf("Expected changing the password to only warn about the seed, got %v", diags)
+	}
+	if len(stub.applied) != 1 {
+		t.Errorf("Expected the user to be applied, got %d configurations applied", len(stub.applied))
+	}
+}
+
+func TestJCasCClient_planLocalUsersExclusive(t *testing.T) {
+	stub := &jcascStub{}
+	client := &jcascClient{newTestClient(t, newJenkinsStub(t, stub.scriptConsole(t), stub.endpoints()...))}
+
+	plan := func(usernames []interface{}) error {
+		config := terraform.NewResourceConfigRaw(map[string]interface{}{"usernames": usernames})
+		_, err := schema.InternalMap(resourceLocalUsersExclusiveSchema).Diff(context.Background(), nil, config, resourceLocalUsersExclusiveCustomizeDiff, client, false)
+		return err
+	}
+
+	if err := plan([]interface{}{"ALICE"}); err != nil {
+		t.Errorf("Expected no deletion to be planned, got %v", err)
+	}
+	if err := plan([]interface{}{}); !errors.Is(err, errScriptAccessRequired) {
+		t.Errorf("Expected deleting alice to require script access, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package jenkins
+
+import (
+	"sync"
+)
+
+// authorizationStrategyLock serializes the changes to the authorization strategy,
+// shared by every jenkins_authorization_global_matrix resource
+const authorizationStrategyLock = "authorization_strategy"
+
+// keyedMutex serializes the mutations of shared controller-wide objects, one lock per key
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock acquires the lock of the key and returns the function releasing it
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*sync.Mutex{}
+	}
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		k.locks[key] = lock
+	}
+	k.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
@@ -0,0 +1,109 @@
+package jenkins
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	stubGrantUsername    = regexp.MustCompile(`strategy\.add\(permissionIds\[it\], '([^']+)'\)`)
+	stubGrantPermissions = regexp.MustCompile(`def user_permissions = \[(.*)\]`)
+)
+
+// matrixStub stands in for the global matrix authorization strategy. Like concurrent
+// Groovy scripts without synchronization, it reads, modifies then writes back the whole matrix.
+type matrixStub struct {
+	mu      sync.Mutex
+	granted map[string][]string
+}
+
+func (s *matrixStub) handle(w http.ResponseWriter, r *http.Request) {
+	script := r.FormValue("script")
+	username := stubGrantUsername.FindStringSubmatch(script)
+	permissions := stubGrantPermissions.FindStringSubmatch(script)
+	if username == nil || permissions == nil {
+		http.Error(w, "unexpected script", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	granted := map[string][]string{}
+	for user, userPermissions := range s.granted {
+		granted[user] = userPermissions
+	}
+	s.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+	granted[username[1]] = strings.FieldsFunc(permissions[1], func(r rune) bool { return r == '\'' || r == ',' })
+
+	s.mu.Lock()
+	s.granted = granted
+	s.mu.Unlock()
+
+	w.Write([]byte(`{"error": false, "msg": "", "data": {}}`))
+}
+
+func TestUserPermissions_parallelWritesKeepGrants(t *testing.T) {
+	stub := &matrixStub{granted: map[string][]string{}}
+	client := newTestClient(t, newJenkinsStub(t, stub.handle))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			username := fmt.Sprintf("user%d", i)
+			if i%2 == 0 {
+				errs <- client.CreateUserPermissions(context.Background(), username, []string{"Overall/Read"})
+			} else {
+				errs <- client.UpdateUserPermissions(context.Background(), username, []string{"Overall/Read", "Job/Build"})
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if len(stub.granted) != 20 {
+		t.Errorf("Expected grants of 20 users, got %d: %v", len(stub.granted), stub.granted)
+	}
+}
+
+func TestKeyedMutex(t *testing.T) {
+	var locks keyedMutex
+
+	unlock := locks.lock("a")
+	acquired := make(chan struct{})
+	go func() {
+		defer locks.lock("a")()
+		close(acquired)
+	}()
+
+	// Another key is not blocked
+	locks.lock("b")()
+
+	select {
+	case <-acquired:
+		t.Fatalf("Expected lock of the same key to wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected lock to be acquired once released")
+	}
+}
@@ -0,0 +1,78 @@
+package jenkins
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const redacted = "<redacted>"
+
+// logScript writes a debug log entry for a script sent to Jenkins.
+// The script itself is never logged since it embeds its parameters.
+func logScript(script groovyScript, data interface{}, result scriptResult, err error, duration time.Duration) {
+	status := "none"
+	if result.statusCode != 0 {
+		status = fmt.Sprint(result.statusCode)
+	}
+
+	entry := fmt.Sprintf("script=%s params={%s} duration=%s status=%s",
+		script.name, formatScriptParams(data), duration.Round(time.Millisecond), status)
+	if err != nil {
+		log.Printf("[DEBUG] Jenkins script failed: %s error=%q", entry, err)
+		return
+	}
+	log.Printf("[DEBUG] Jenkins script sent: %s", entry)
+}
+
+// logBatchedScript writes a debug log entry for a script queued in a batch.
+// The outcome is logged once for the whole batch.
+func logBatchedScript(script groovyScript, data interface{}) {
+	log.Printf("[DEBUG] Jenkins script batched: script=%s params={%s}", script.name, formatScriptParams(data))
+}
+
+// formatScriptParams formats the exported fields of the script data as key=value pairs.
+// Fields tagged with redact:"true" are replaced by a placeholder.
+func formatScriptParams(data interface{}) string {
+	if data == nil {
+		return ""
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(data))
+	if value.Kind() != reflect.Struct {
+		return redacted
+	}
+
+	params := []string{}
+	visitScriptParams(value, func(name string, value interface{}) {
+		params = append(params, fmt.Sprintf("%s=%v", name, value))
+	})
+	return strings.Join(params, " ")
+}
+
+// visitScriptParams calls visit with the exported fields of the script data that are set,
+// in order, with the redacted fields replaced by a placeholder
+func visitScriptParams(value reflect.Value, visit func(name string, value interface{})) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			visitScriptParams(value.Field(i), visit)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+		switch {
+		case field.Tag.Get("redact") == "true":
+			visit(field.Name, redacted)
+		case fieldValue.IsZero():
+			continue
+		default:
+			visit(field.Name, fieldValue.Interface())
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package jenkins
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFormatScriptParams(t *testing.T) {
+	params := formatScriptParams(jenkinsLocalUserCreate{
+		Password: "s3cr3t",
+		jenkinsLocalUser: jenkinsLocalUser{
+			Username: "john",
+			Email:    "john@example.com",
+		},
+	})
+
+	if strings.Contains(params, "s3cr3t") {
+		t.Errorf("Expected password to be redacted, got %s", params)
+	}
+	for _, expected := range []string{"Password=<redacted>", "Username=john", "Email=john@example.com"} {
+		if !strings.Contains(params, expected) {
+			t.Errorf("Expected %q in %s", expected, params)
+		}
+	}
+}
+
+func TestCreateLocalUser_noSecretInLogs(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	client := newTestClient(t, newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error": false, "msg": "", "data": {}}`))
+	}))
+
+	if err := client.CreateLocalUser(context.Background(), "john", "s3cr3t", "John", "john@example.com", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if strings.Contains(logs.String(), "s3cr3t") {
+		t.Errorf("Expected password not to be logged, got %s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "script=create_local_user") {
+		t.Errorf("Expected script to be logged, got %s", logs.String())
+	}
+}
@@ -0,0 +1,57 @@
+package jenkins
+
+import (
+	"context"
+)
+
+// GetUserPermissions returns the permissions granted to the user in the global matrix.
+// The whole matrix is fetched by the first call and served from cache until a change
+// invalidates it, so refreshing many resources runs a single script.
+func (j *jenkinsAdapter) GetUserPermissions(ctx context.Context, username string) (jenkinsUserPermissions, error) {
+	return j.cachedUserPermissions(ctx, username, j.fetchGlobalMatrix)
+}
+
+// fetchGlobalMatrix returns the permissions granted to every user in the global matrix
+func (j *jenkinsAdapter) fetchGlobalMatrix(ctx context.Context) (map[string][]string, error) {
+	response := jenkinsResponseGlobalMatrix{}
+	if err := j.runScript(ctx, getGlobalMatrixScript, nil, &response); err != nil {
+		return nil, err
+	}
+
+	if response.Error {
+		return nil, &jenkinsError{code: response.Code, message: response.Message}
+	}
+
+	return response.Data, nil
+}
+
+// cachedUserPermissions returns the permissions of the user from the cached global matrix,
+// fetching the matrix when it is not cached yet
+func (j *jenkinsAdapter) cachedUserPermissions(ctx context.Context, username string, fetch func(context.Context) (map[string][]string, error)) (jenkinsUserPermissions, error) {
+	j.globalMatrixLock.Lock()
+	defer j.globalMatrixLock.Unlock()
+
+	if j.globalMatrix == nil {
+		matrix, err := fetch(ctx)
+		if err != nil {
+			return jenkinsUserPermissions{}, err
+		}
+
+		j.globalMatrix = matrix
+		if j.globalMatrix == nil {
+			j.globalMatrix = map[string][]string{}
+		}
+	}
+
+	permissions := append([]string{}, j.globalMatrix[username]...)
+	return jenkinsUserPermissions{Username: username, Permissions: permissions}, nil
+}
+
+// invalidateGlobalMatrix drops the cached global matrix after a change. It waits for a
+// fetch in flight, which may have read the matrix before the change.
+func (j *jenkinsAdapter) invalidateGlobalMatrix() {
+	j.globalMatrixLock.Lock()
+	defer j.globalMatrixLock.Unlock()
+
+	j.globalMatrix = nil
+}
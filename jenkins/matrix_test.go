@@ -0,0 +1,54 @@
+package jenkins
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetUserPermissions_cachesGlobalMatrix(t *testing.T) {
+	var fetches int32
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.FormValue("script"), "strategy.add(") {
+			w.Write([]byte(`{"error": false, "msg": "", "data": {}}`))
+			return
+		}
+		atomic.AddInt32(&fetches, 1)
+		w.Write([]byte(`{"error": false, "msg": "", "data": {"alice": ["Overall/Read", "Job/Build"], "bob": ["Overall/Administer"]}}`))
+	})
+	client := newTestClient(t, server)
+
+	cases := []struct {
+		username    string
+		permissions []string
+	}{
+		{"alice", []string{"Overall/Read", "Job/Build"}},
+		{"bob", []string{"Overall/Administer"}},
+		{"carol", []string{}},
+	}
+	for _, c := range cases {
+		userPermissions, err := client.GetUserPermissions(context.Background(), c.username)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if userPermissions.Username != c.username || !reflect.DeepEqual(userPermissions.Permissions, c.permissions) {
+			t.Errorf("Expected permissions %v of %s, got %v", c.permissions, c.username, userPermissions)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Expected the global matrix to be fetched once, got %d", fetches)
+	}
+
+	if err := client.CreateUserPermissions(context.Background(), "carol", []string{"Overall/Read"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := client.GetUserPermissions(context.Background(), "carol"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fetches != 2 {
+		t.Errorf("Expected the global matrix to be fetched again after a change, got %d fetches", fetches)
+	}
+}
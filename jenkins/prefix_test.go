@@ -0,0 +1,181 @@
+package jenkins
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// prefixedJenkinsStub stands in for a Jenkins controller served under /jenkins behind a reverse
+// proxy, which redirects the former /ci context path. Like Jenkins, it only accepts scripts
+// with a crumb issued for the session of their cookie.
+type prefixedJenkinsStub struct {
+	mu       sync.Mutex
+	sessions int
+	crumbs   int
+	expired  map[string]bool
+	scripts  []string
+}
+
+// expire ends the sessions started so far, like a restart of Jenkins
+func (s *prefixedJenkinsStub) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expired == nil {
+		s.expired = map[string]bool{}
+	}
+	for i := 1; i <= s.sessions; i++ {
+		s.expired["session-"+strconv.Itoa(i)] = true
+	}
+}
+
+// endpoints serves the crumb issuer and the reverse proxy
+func (s *prefixedJenkinsStub) endpoints() []jenkinsStubOption {
+	return []jenkinsStubOption{
+		withStubEndpoint("/crumbIssuer/api/json", func(w http.ResponseWriter, r *http.Request) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.crumbs++
+			session := ""
+			if cookie, err := r.Cookie("JSESSIONID"); err == nil && !s.expired[cookie.Value] {
+				session = cookie.Value
+			} else {
+				s.sessions++
+				session = "session-" + strconv.Itoa(s.sessions)
+				http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: session, Path: "/jenkins", HttpOnly: true})
+			}
+			w.Write([]byte(`{"crumbRequestField": "Jenkins-Crumb", "crumb": "crumb-` + session + `"}`))
+		}),
+		withStubProxy(func(jenkins http.Handler) http.Handler {
+			proxy := http.NewServeMux()
+			proxy.Handle("/jenkins/", http.StripPrefix("/jenkins", jenkins))
+			proxy.HandleFunc("/ci/", func(w http.ResponseWriter, r *http.Request) {
+				target := "/jenkins/" + strings.TrimPrefix(r.URL.Path, "/ci/")
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusFound)
+			})
+			return proxy
+		}),
+	}
+}
+
+func (s *prefixedJenkinsStub) handleScript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cookie, err := r.Cookie("JSESSIONID")
+	if err != nil || s.expired[cookie.Value] || r.Header.Get("Jenkins-Crumb") != "crumb-"+cookie.Value {
+		http.Error(w, "No valid crumb was included in the request", http.StatusForbidden)
+		return
+	}
+
+	s.scripts = append(s.scripts, r.FormValue("script"))
+	w.Write([]byte(`{"error": false, "msg": "", "data": [{"username": "alice"}]}`))
+}
+
+func TestPathPrefix_scriptText(t *testing.T) {
+	stub := &prefixedJenkinsStub{}
+	server := newJenkinsStub(t, stub.handleScript, stub.endpoints()...)
+	client := newTestClient(t, server, withServerPath("/jenkins/"))
+
+	for i := 0; i < 2; i++ {
+		users, err := client.GetLocalUsers(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(users) != 1 || users[0].Username != "alice" {
+			t.Errorf("Unexpected users: %v", users)
+		}
+	}
+
+	if stub.sessions != 1 {
+		t.Errorf("Expected the session to be kept between scripts, got %d sessions", stub.sessions)
+	}
+}
+
+func TestPathPrefix_cachesCrumb(t *testing.T) {
+	stub := &prefixedJenkinsStub{}
+	server := newJenkinsStub(t, stub.handleScript, stub.endpoints()...)
+	client := newTestClient(t, server, withServerPath("/jenkins/"))
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetLocalUsers(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if stub.crumbs != 1 {
+		t.Errorf("Expected the crumb to be fetched once per session, got %d fetches", stub.crumbs)
+	}
+
+	stub.expire()
+	if _, err := client.GetLocalUsers(context.Background()); err != nil {
+		t.Fatalf("Expected a crumb rejected with its session to be fetched again, got %v", err)
+	}
+	if stub.crumbs != 2 || stub.sessions != 2 || len(stub.scripts) != 4 {
+		t.Errorf("Expected the script to run in a new session, got %d crumbs, %d sessions and %d scripts", stub.crumbs, stub.sessions, len(stub.scripts))
+	}
+}
+
+func TestPathPrefix_redirects(t *testing.T) {
+	stub := &prefixedJenkinsStub{}
+	server := newJenkinsStub(t, stub.handleScript, stub.endpoints()...)
+	client := newTestClient(t, server, withServerPath("/ci"))
+
+	if _, err := client.GetLocalUsers(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(stub.scripts) != 1 || !strings.Contains(stub.scripts[0], "getAllUsers") {
+		t.Errorf("Expected the script to be posted again to the redirected location, got %v", stub.scripts)
+	}
+}
+
+func TestPathPrefix_redirectToAnotherHost(t *testing.T) {
+	posts := 0
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		http.Redirect(w, r, "http://jenkins.example.com/jenkins/scriptText", http.StatusTemporaryRedirect)
+	})
+	client := newTestClient(t, server)
+
+	_, err := client.GetLocalUsers(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "another host, jenkins.example.com") {
+		t.Fatalf("Expected a redirect to another host to be rejected, got %v", err)
+	}
+	if posts != 1 {
+		t.Errorf("Expected a rejected redirect not to be retried, got %d posts", posts)
+	}
+}
+
+func TestPathPrefix_provider(t *testing.T) {
+	stub := &prefixedJenkinsStub{}
+	server := newJenkinsStub(t, stub.handleScript, stub.endpoints()...)
+
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+		"server_url": server.URL + "/jenkins",
+		"username":   "admin",
+		"password":   "adminpwd",
+	})
+	m, diags := configureProvider(context.Background(), d)
+	if diags.HasError() {
+		t.Fatalf("Unexpected error: %v", diags)
+	}
+
+	data := schema.TestResourceDataRaw(t, dataSourceLocalUsers().Schema, map[string]interface{}{})
+	if diags := dataSourceLocalUsersRead(context.Background(), data, m); diags.HasError() {
+		t.Fatalf("Unexpected error: %v", diags)
+	}
+	if username := data.Get("users.0.username"); username != "alice" {
+		t.Errorf("Expected user alice, got %v", username)
+	}
+}
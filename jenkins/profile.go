@@ -0,0 +1,136 @@
+package jenkins
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultConfigFile holds the named connection profiles
+const defaultConfigFile = "~/.jenkins/config"
+
+// profileKeys are the provider attributes a profile can set
+var profileKeys = []string{
+	"server_url",
+	"username",
+	"password",
+	"password_file",
+	"api_token",
+	"api_token_file",
+	"token",
+	"token_file",
+	"ca_cert",
+	"client_cert",
+	"client_key",
+	"tls_min_version",
+	"tls_server_name",
+	"verify_ssl",
+}
+
+// profileCredentialKeys are the secrets of a profile. They are ignored altogether, with the
+// username of the profile, when credentials are set explicitly rather than mixed with them.
+var profileCredentialKeys = []string{
+	"password",
+	"password_file",
+	"api_token",
+	"api_token_file",
+	"token",
+	"token_file",
+}
+
+// loadProfile reads the named profile of the config file. No profile is loaded without a name.
+func loadProfile(path string, name string) (map[string]string, error) {
+	if name == "" {
+		return map[string]string{}, nil
+	}
+
+	if path == "" {
+		path = defaultConfigFile
+	}
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to locate the Jenkins config file %s: %v", path, err)
+		}
+		path = filepath.Join(home, path[2:])
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Jenkins profile %s: %v", name, err)
+	}
+	defer file.Close()
+
+	profiles, err := parseProfiles(file)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Jenkins config file %s: %v", path, err)
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("Jenkins profile %s not found in %s", name, path)
+	}
+	return profile, nil
+}
+
+// parseProfiles reads profiles in the INI format:
+//
+//	[production]
+//	server_url = https://jenkins.example.com
+//	username   = terraform
+//	api_token_file = /run/secrets/jenkins_token
+//
+// Lines starting with # or ; are comments.
+func parseProfiles(r io.Reader) (map[string]map[string]string, error) {
+	profiles := map[string]map[string]string{}
+	var profile map[string]string
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return nil, fmt.Errorf("line %d: empty profile name", lineNumber)
+			}
+			profile = map[string]string{}
+			profiles[name] = profile
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expecting a [profile] or a key = value", lineNumber)
+		}
+		if profile == nil {
+			return nil, fmt.Errorf("line %d: %s is not in a [profile]", lineNumber, strings.TrimSpace(parts[0]))
+		}
+
+		key := strings.TrimSpace(parts[0])
+		if !isProfileKey(key) {
+			return nil, fmt.Errorf("line %d: unsupported key %s, expecting one of %s", lineNumber, key, strings.Join(profileKeys, ", "))
+		}
+		profile[key] = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+func isProfileKey(key string) bool {
+	for _, profileKey := range profileKeys {
+		if key == profileKey {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package jenkins
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const testConfigFile = `
+# Connection profiles
+[default]
+server_url = https://jenkins.example.com
+
+[production]
+server_url = "https://jenkins.prod.example.com"
+username   = terraform
+password   = s3cr3t
+verify_ssl = false
+`
+
+func TestParseProfiles(t *testing.T) {
+	profiles, err := parseProfiles(strings.NewReader(testConfigFile))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	production := profiles["production"]
+	if production["server_url"] != "https://jenkins.prod.example.com" || production["username"] != "terraform" || production["verify_ssl"] != "false" {
+		t.Errorf("Unexpected production profile: %v", production)
+	}
+	if profiles["default"]["server_url"] != "https://jenkins.example.com" {
+		t.Errorf("Unexpected default profile: %v", profiles["default"])
+	}
+
+	invalid := map[string]string{
+		"key outside profile": "server_url = https://jenkins.example.com",
+		"unsupported key":     "[default]\nserver = https://jenkins.example.com",
+		"missing value":       "[default]\nserver_url",
+		"empty profile name":  "[ ]",
+	}
+	for name, content := range invalid {
+		if _, err := parseProfiles(strings.NewReader(content)); err == nil {
+			t.Errorf("Expected error for %s", name)
+		}
+	}
+}
+
+func TestConfigureProvider_profile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := ioutil.WriteFile(path, []byte(testConfigFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		raw      map[string]interface{}
+		expected Config
+	}{
+		{
+			name:     "profile",
+			raw:      map[string]interface{}{},
+			expected: Config{ServerURL: "https://jenkins.prod.example.com", Username: "terraform", Password: "s3cr3t", VerifySSL: false},
+		},
+		{
+			name:     "explicit attributes take precedence",
+			raw:      map[string]interface{}{"server_url": "https://jenkins.test", "verify_ssl": true},
+			expected: Config{ServerURL: "https://jenkins.test", Username: "terraform", Password: "s3cr3t", VerifySSL: true},
+		},
+		{
+			name:     "explicit credentials replace the profile ones",
+			raw:      map[string]interface{}{"username": "ci", "api_token": "t0k3n"},
+			expected: Config{ServerURL: "https://jenkins.prod.example.com", Username: "ci", APIToken: "t0k3n", VerifySSL: false},
+		},
+		{
+			name:     "explicit bearer token drops the profile username",
+			raw:      map[string]interface{}{"token": "b34r3r"},
+			expected: Config{ServerURL: "https://jenkins.prod.example.com", Token: "b34r3r", VerifySSL: false},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.raw["config_file"] = path
+			c.raw["profile"] = "production"
+			d := schema.TestResourceDataRaw(t, Provider().Schema, c.raw)
+
+			m, diags := configureProvider(context.Background(), d)
+			if diags.HasError() {
+				t.Fatalf("Unexpected error: %v", diags)
+			}
+
+			config := m.(*jenkinsAdapter).config
+			actual := Config{
+				ServerURL: config.ServerURL,
+				Username:  config.Username,
+				Password:  config.Password,
+				APIToken:  config.APIToken,
+				Token:     config.Token,
+				VerifySSL: config.VerifySSL,
+			}
+			if actual.ServerURL != c.expected.ServerURL || actual.Username != c.expected.Username ||
+				actual.Password != c.expected.Password || actual.APIToken != c.expected.APIToken ||
+				actual.Token != c.expected.Token || actual.VerifySSL != c.expected.VerifySSL {
+				t.Errorf("Expected %+v, got %+v", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConfigureProvider_unknownProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := ioutil.WriteFile(path, []byte(testConfigFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+		"config_file": path,
+		"profile":     "staging",
+	})
+	if _, diags := configureProvider(context.Background(), d); !diags.HasError() {
+		t.Errorf("Expected unknown profile to fail")
+	}
+}
@@ -2,55 +2,254 @@ package jenkins
 
 import (
 	"context"
-	"os"
+	"strconv"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 // Provider - create a new Jenkins provider
 func Provider() *schema.Provider {
 	return &schema.Provider{
 		Schema: map[string]*schema.Schema{
+			"profile": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_PROFILE", nil),
+				Description: "The named profile of the config file providing the connection settings. Attributes set explicitly take precedence.",
+			},
+			"config_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_CONFIG_FILE", defaultConfigFile),
+				Description: "The path to the config file holding the named profiles.",
+			},
 			"server_url": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("JENKINS_URL", nil),
-				Description: "The URL of the Jenkins server to connect to.",
+				Description: "The URL of the Jenkins server to connect to. Required unless transport is ssh.",
 			},
 			"ca_cert": {
 				Type:        schema.TypeString,
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("JENKINS_CA_CERT", nil),
-				Description: "The path to the Jenkins self-signed certificate.",
+				Description: "The Jenkins self-signed certificate or CA certificates, as inline PEM or the path to a bundle file or a directory.",
 			},
 			"username": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("JENKINS_USERNAME", nil),
-				Description: "Username to authenticate to Jenkins.",
+				Description: "Username to authenticate to Jenkins with a password or an API token.",
 			},
 			"password": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
+				Sensitive:   true,
 				DefaultFunc: schema.EnvDefaultFunc("JENKINS_PASSWORD", nil),
 				Description: "Password to authenticate to Jenkins. User API Token can be used to replace user password.",
 			},
+			"password_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_PASSWORD_FILE", nil),
+				Description: "Path to a file containing the password to authenticate to Jenkins.",
+			},
+			"api_token": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_API_TOKEN", nil),
+				Description: "User API token to authenticate to Jenkins.",
+			},
+			"api_token_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_API_TOKEN_FILE", nil),
+				Description: "Path to a file containing the user API token to authenticate to Jenkins.",
+			},
+			"token": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_TOKEN", nil),
+				Description: "Bearer token to authenticate to Jenkins, e.g. behind an OAuth proxy or SSO gateway.",
+			},
+			"token_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_TOKEN_FILE", nil),
+				Description: "Path to a file containing the bearer token to authenticate to Jenkins.",
+			},
+			"credential_command": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "A command, and its arguments, printing the credentials as JSON with username and one of password, api_token or token. It runs again when Jenkins rejects the credentials.",
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.StringIsNotEmpty,
+				},
+			},
+			"headers": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Sensitive:   true,
+				Description: "Additional HTTP headers sent with every request to Jenkins.",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"client_cert": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_CLIENT_CERT", nil),
+				Description: "The client certificate for mutual TLS, as a path or inline PEM.",
+			},
+			"client_key": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_CLIENT_KEY", nil),
+				Description: "The private key of the client certificate, as a path or inline PEM.",
+			},
+			"tls_min_version": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice([]string{"1.0", "1.1", "1.2", "1.3"}, false),
+				Description:  "The minimum TLS version accepted when connecting to Jenkins.",
+			},
+			"tls_server_name": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The server name used to verify the Jenkins certificate, instead of the server_url host.",
+			},
+			"proxy_url": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_PROXY_URL", nil),
+				Description: "The URL of the HTTP proxy used to reach Jenkins. Defaults to the HTTP_PROXY and HTTPS_PROXY environment variables.",
+			},
+			"no_proxy": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Hosts, domains and CIDR ranges reached without proxy. Defaults to the NO_PROXY environment variable.",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"request_timeout": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "5m",
+				ValidateFunc: validateDuration,
+				Description:  "The maximum duration of a request to Jenkins, including reading the response. 0 means no timeout.",
+			},
+			"connect_timeout": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "30s",
+				ValidateFunc: validateDuration,
+				Description:  "The maximum duration to establish a connection to Jenkins, including the TLS handshake.",
+			},
+			"max_idle_connections": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      10,
+				ValidateFunc: validation.IntAtLeast(1),
+				Description:  "The maximum number of idle connections kept open to Jenkins.",
+			},
+			"max_retries": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      3,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "The maximum number of retries of a call to Jenkins failing for a transient reason, e.g. while Jenkins restarts.",
+			},
+			"retry_wait_min": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "1s",
+				ValidateFunc: validateDuration,
+				Description:  "The wait before the first retry, doubled at each retry.",
+			},
+			"retry_wait_max": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "30s",
+				ValidateFunc: validateDuration,
+				Description:  "The maximum wait between two retries.",
+			},
+			"read_only": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_READ_ONLY", false),
+				Description: "Reject every change to Jenkins, e.g. to detect drift on production. Data sources and refreshes keep working.",
+			},
+			"audit_log": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_AUDIT_LOG", nil),
+				Description: "Path to a local file where every operation sent to Jenkins is appended as a JSON line, with its secrets redacted.",
+			},
+			"transport": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      transportScript,
+				ValidateFunc: validation.StringInSlice([]string{transportScript, transportJCasC, transportSSH}, false),
+				Description:  "How changes are applied: script through the script console, jcasc through the configuration-as-code plugin when the script console is disabled, or ssh through the Jenkins CLI over SSH.",
+			},
+			"ssh_address": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_SSH_ADDRESS", nil),
+				Description: "The host and port of the Jenkins SSH server, used with the ssh transport.",
+			},
+			"ssh_private_key": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_SSH_PRIVATE_KEY", nil),
+				Description: "The private SSH key of the user, as a path or inline PEM, used with the ssh transport.",
+			},
+			"ssh_host_key": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_SSH_HOST_KEY", nil),
+				Description: "The public host key of the Jenkins SSH server, e.g. \"ssh-ed25519 AAAA...\", used with the ssh transport.",
+			},
+			"batch_window": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "0s",
+				ValidateFunc: validateDuration,
+				Description:  "How long scripts wait to be sent together in a single call to Jenkins. 0 disables batching.",
+			},
+			"batch_max_size": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      50,
+				ValidateFunc: validation.IntAtLeast(1),
+				Description:  "The maximum number of scripts sent together in a single call to Jenkins.",
+			},
 			"verify_ssl": {
 				Type:        schema.TypeBool,
 				Optional:    true,
-				DefaultFunc: schema.EnvDefaultFunc("JENKINS_VERIFY_SSL", true),
-				Description: "Flag to turn off ssl verification",
+				DefaultFunc: schema.EnvDefaultFunc("JENKINS_VERIFY_SSL", nil),
+				Description: "Flag to turn off ssl verification. Defaults to true.",
 			},
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
-			"jenkins_local_user":                  resourceLocalUser(),
-			"jenkins_authorization_global_matrix": resourceAuthorizationGlobalMatrix(),
+			"jenkins_local_user":                  auditResource("jenkins_local_user", resourceLocalUser()),
+			"jenkins_local_users_exclusive":       auditResource("jenkins_local_users_exclusive", resourceLocalUsersExclusive()),
+			"jenkins_authorization_global_matrix": auditResource("jenkins_authorization_global_matrix", resourceAuthorizationGlobalMatrix()),
 		},
 
 		DataSourcesMap: map[string]*schema.Resource{
-			"jenkins_local_user": dataSourceLocalUser(),
+			"jenkins_local_user":  auditResource("data.jenkins_local_user", dataSourceLocalUser()),
+			"jenkins_local_users": auditResource("data.jenkins_local_users", dataSourceLocalUsers()),
 		},
 
 		ConfigureContextFunc: configureProvider,
@@ -58,25 +257,134 @@ func Provider() *schema.Provider {
 }
 
 func configureProvider(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+	profile, err := loadProfile(d.Get("config_file").(string), d.Get("profile").(string))
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
+
+	// Credentials set explicitly replace the ones of the profile, rather than mixing with them
+	explicitCredentials := len(d.Get("credential_command").([]interface{})) > 0
+	for _, key := range profileCredentialKeys {
+		explicitCredentials = explicitCredentials || d.Get(key).(string) != ""
+	}
+	if explicitCredentials {
+		for _, key := range profileCredentialKeys {
+			delete(profile, key)
+		}
+		// The username of the profile goes with its credentials, e.g. it cannot be used with a bearer token
+		delete(profile, "username")
+	}
+
+	// Attributes and environment variables take precedence over the profile
+	get := func(key string) string {
+		if value := d.Get(key).(string); value != "" {
+			return value
+		}
+		return profile[key]
+	}
+
+	verifySSL := true
+	if v, ok := d.GetOkExists("verify_ssl"); ok {
+		verifySSL = v.(bool)
+	} else if v, ok := profile["verify_ssl"]; ok {
+		if verifySSL, err = strconv.ParseBool(v); err != nil {
+			return nil, diag.Errorf("Invalid verify_ssl %q in Jenkins profile %s", v, d.Get("profile").(string))
+		}
+	}
+
 	config := Config{
-		ServerURL: d.Get("server_url").(string),
-		Username:  d.Get("username").(string),
-		Password:  d.Get("password").(string),
-		VerifySSL: d.Get("verify_ssl").(bool),
+		ServerURL: get("server_url"),
+		CACert:    get("ca_cert"),
+		Username:  get("username"),
+		Password:  get("password"),
+		APIToken:  get("api_token"),
+		Token:     get("token"),
+		Headers:   map[string]string{},
+		VerifySSL: verifySSL,
+
+		ClientCert:    get("client_cert"),
+		ClientKey:     get("client_key"),
+		TLSMinVersion: get("tls_min_version"),
+		TLSServerName: get("tls_server_name"),
+
+		ProxyURL:           d.Get("proxy_url").(string),
+		MaxIdleConnections: d.Get("max_idle_connections").(int),
+		MaxRetries:         d.Get("max_retries").(int),
+		BatchMaxSize:       d.Get("batch_max_size").(int),
+
+		ReadOnly: d.Get("read_only").(bool),
+		AuditLog: d.Get("audit_log").(string),
+
+		Transport:     d.Get("transport").(string),
+		SSHAddress:    d.Get("ssh_address").(string),
+		SSHPrivateKey: d.Get("ssh_private_key").(string),
+		SSHHostKey:    d.Get("ssh_host_key").(string),
+	}
+
+	for _, arg := range d.Get("credential_command").([]interface{}) {
+		config.CredentialCommand = append(config.CredentialCommand, arg.(string))
+	}
+
+	for _, host := range d.Get("no_proxy").([]interface{}) {
+		config.NoProxy = append(config.NoProxy, host.(string))
 	}
 
-	var err error
-	if d.Get("ca_cert").(string) != "" {
-		config.CACert, err = os.Open(d.Get("ca_cert").(string))
+	// Durations are validated by the schema
+	config.RequestTimeout, _ = time.ParseDuration(d.Get("request_timeout").(string))
+	config.ConnectTimeout, _ = time.ParseDuration(d.Get("connect_timeout").(string))
+	config.RetryWaitMin, _ = time.ParseDuration(d.Get("retry_wait_min").(string))
+	config.RetryWaitMax, _ = time.ParseDuration(d.Get("retry_wait_max").(string))
+	config.BatchWindow, _ = time.ParseDuration(d.Get("batch_window").(string))
+
+	for name, value := range d.Get("headers").(map[string]interface{}) {
+		config.Headers[name] = value.(string)
+	}
+
+	secretFiles := []struct {
+		key    string
+		target *string
+	}{
+		{"password", &config.Password},
+		{"api_token", &config.APIToken},
+		{"token", &config.Token},
+	}
+	for _, secret := range secretFiles {
+		path := get(secret.key + "_file")
+		if path == "" {
+			continue
+		}
+		if *secret.target != "" {
+			return nil, diag.Errorf("Only one of %s and %s_file can be set", secret.key, secret.key)
+		}
+
+		value, err := readSecretFile(path)
 		if err != nil {
-			return nil, diag.Errorf("Unable to open certificate file %s: %s", d.Get("ca_cert").(string), err.Error())
+			return nil, diag.FromErr(err)
+		}
+		*secret.target = value
+	}
+
+	// Unknown values of the provider configuration are empty while planning. The configuration
+	// is validated now once server_url and the credentials are set, and on first use otherwise.
+	if config.Transport != transportSSH && config.ServerURL != "" && len(config.authModes()) > 0 {
+		if err := config.validate(); err != nil {
+			return nil, diag.FromErr(err)
 		}
 	}
 
-	client := newJenkinsClient(&config)
-	if _, err = client.Init(); err != nil {
+	client, err := newJenkinsClient(&config)
+	if err != nil {
 		return nil, diag.FromErr(err)
 	}
 
-	return client, nil
+	// The client connects on first use, since the provider configuration may not be
+	// known yet while planning, e.g. when server_url comes from another resource
+	var configured jenkinsClient = client
+	if config.Transport == transportJCasC {
+		configured = &jcascClient{client}
+	}
+	if config.ReadOnly {
+		configured = readOnlyClient{configured}
+	}
+	return configured, nil
 }
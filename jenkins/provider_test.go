@@ -1,7 +1,12 @@
 package jenkins
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -34,3 +39,81 @@ func testAccPreCheck(t *testing.T) {
 		t.Fatal("JENKINS_PASSWORD must be set for acceptance tests")
 	}
 }
+
+func TestConfigureProvider_unknownServerURL(t *testing.T) {
+	// Unknown values of the provider configuration are empty while planning
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{})
+
+	m, diags := configureProvider(context.Background(), d)
+	if diags.HasError() {
+		t.Fatalf("Expected configuration to be deferred, got %v", diags)
+	}
+
+	client := m.(jenkinsClient)
+	if _, err := client.GetCapabilities(withPlanning(context.Background())); !errors.Is(err, errProviderConfigUnknown) {
+		t.Errorf("Expected unknown configuration error, got %v", err)
+	}
+	if _, err := client.GetCapabilities(context.Background()); !errors.Is(err, errServerURLMissing) {
+		t.Errorf("Expected missing server_url error once applying, got %v", err)
+	}
+
+	checkRequirements := requireCapabilities("jenkins_authorization_global_matrix", jenkinsRequirements{plugins: []string{"matrix-auth"}})
+	if err := checkRequirements(context.Background(), nil, m); err != nil {
+		t.Errorf("Expected requirements check to be skipped, got %v", err)
+	}
+}
+
+func TestConfigureProvider_validates(t *testing.T) {
+	cases := []struct {
+		raw      map[string]interface{}
+		expected string
+	}{
+		{
+			map[string]interface{}{"server_url": "jenkins.example.com", "username": "admin", "password": "adminpwd"},
+			"must be an absolute http or https URL",
+		},
+		{
+			map[string]interface{}{"server_url": "https://jenkins.example.com", "username": "admin", "token": "bearer"},
+			"username cannot be used with a bearer token",
+		},
+		{
+			map[string]interface{}{"server_url": "https://jenkins.example.com", "password": "adminpwd"},
+			"username must be set when authenticating with password",
+		},
+	}
+
+	for _, c := range cases {
+		d := schema.TestResourceDataRaw(t, Provider().Schema, c.raw)
+		_, diags := configureProvider(context.Background(), d)
+		if !diags.HasError() || !strings.Contains(diags[0].Summary, c.expected) {
+			t.Errorf("Expected %q when configuring %v, got %v", c.expected, c.raw, diags)
+		}
+	}
+}
+
+func TestConfigureProvider_connectsOnFirstUse(t *testing.T) {
+	var calls int32
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(`{"error": false, "msg": "", "data": {"username": "admin"}}`))
+	})
+
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+		"server_url": server.URL,
+		"username":   "admin",
+		"password":   "adminpwd",
+	})
+
+	m, diags := configureProvider(context.Background(), d)
+	if diags.HasError() {
+		t.Fatalf("Unexpected error: %v", diags)
+	}
+	if calls != 0 {
+		t.Errorf("Expected no call to Jenkins while configuring, got %d", calls)
+	}
+
+	username, err := m.(jenkinsClient).GetCurrentUsername(context.Background())
+	if err != nil || username != "admin" {
+		t.Errorf("Expected current user admin, got %q, %v", username, err)
+	}
+}
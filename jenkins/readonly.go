@@ -0,0 +1,54 @@
+package jenkins
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// errReadOnly is returned by the changes attempted while the provider is read-only
+var errReadOnly = errors.New("the provider is read-only, unset read_only to change Jenkins")
+
+func readOnlyError(operation string) error {
+	return fmt.Errorf("%s is not allowed: %w", operation, errReadOnly)
+}
+
+// readOnlyClient rejects every change before anything is sent to Jenkins,
+// for audits and drift detection. Reads are passed through.
+type readOnlyClient struct {
+	jenkinsClient
+}
+
+func (c readOnlyClient) CreateLocalUser(ctx context.Context, username string, password string, fullname string, email string, description string) error {
+	return readOnlyError(fmt.Sprintf("Creating or updating local user %s", username))
+}
+
+func (c readOnlyClient) UpdateLocalUserProperties(ctx context.Context, properties jenkinsLocalUserProperties) error {
+	return readOnlyError(fmt.Sprintf("Updating the properties of local user %s", properties.Username))
+}
+
+func (c readOnlyClient) RenewLocalUserSeed(ctx context.Context, username string) error {
+	return readOnlyError(fmt.Sprintf("Renewing the seed of local user %s", username))
+}
+
+func (c readOnlyClient) DeleteLocalUser(ctx context.Context, username string) error {
+	return readOnlyError(fmt.Sprintf("Deleting local user %s", username))
+}
+
+func (c readOnlyClient) CreateUserPermissions(ctx context.Context, username string, permissions []string) error {
+	return readOnlyError(fmt.Sprintf("Granting permissions to %s", username))
+}
+
+func (c readOnlyClient) UpdateUserPermissions(ctx context.Context, username string, permissions []string) error {
+	return readOnlyError(fmt.Sprintf("Updating the permissions of %s", username))
+}
+
+func (c readOnlyClient) DeleteUserPermissions(ctx context.Context, username string) error {
+	return readOnlyError(fmt.Sprintf("Revoking the permissions of %s", username))
+}
+
+// PostScript is rejected since any script can change Jenkins
+func (c readOnlyClient) PostScript(ctx context.Context, payload bytes.Buffer, respStruct interface{}) error {
+	return readOnlyError("Running a groovy script")
+}
@@ -0,0 +1,63 @@
+package jenkins
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReadOnlyClient_rejectsChanges(t *testing.T) {
+	var scripts int32
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&scripts, 1)
+		w.Write([]byte(`{"error": false, "msg": "", "data": [{"username": "alice"}]}`))
+	})
+	adapter := newTestClient(t, server)
+	adapter.config.ReadOnly = true
+	client := readOnlyClient{adapter}
+	ctx := context.Background()
+
+	changes := map[string]error{
+		"CreateLocalUser":           client.CreateLocalUser(ctx, "alice", "s3cr3t", "Alice", "alice@example.com", ""),
+		"UpdateLocalUserProperties": client.UpdateLocalUserProperties(ctx, jenkinsLocalUserProperties{Username: "alice"}),
+		"RenewLocalUserSeed":        client.RenewLocalUserSeed(ctx, "alice"),
+		"DeleteLocalUser":           client.DeleteLocalUser(ctx, "alice"),
+		"CreateUserPermissions":     client.CreateUserPermissions(ctx, "alice", []string{"Overall/Read"}),
+		"UpdateUserPermissions":     client.UpdateUserPermissions(ctx, "alice", []string{"Overall/Read"}),
+		"DeleteUserPermissions":     client.DeleteUserPermissions(ctx, "alice"),
+		"PostScript":                client.PostScript(ctx, *bytes.NewBufferString("println('')"), &jenkinsResponse{}),
+	}
+	for name, err := range changes {
+		if !errors.Is(err, errReadOnly) {
+			t.Errorf("Expected %s to be rejected, got %v", name, err)
+		}
+	}
+	if scripts != 0 {
+		t.Fatalf("Expected no script to be sent, got %d", scripts)
+	}
+
+	users, err := client.GetLocalUsers(ctx)
+	if err != nil {
+		t.Fatalf("Expected reads to keep working, got %v", err)
+	}
+	if len(users) != 1 || users[0].Username != "alice" {
+		t.Errorf("Unexpected users: %v", users)
+	}
+}
+
+func TestPostScript_readOnlyRejectsMutatingScripts(t *testing.T) {
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected script sent: %s", r.FormValue("script"))
+	})
+	client := newTestClient(t, server)
+	client.config.ReadOnly = true
+
+	err := client.DeleteLocalUser(context.Background(), "alice")
+	if !errors.Is(err, errReadOnly) || !strings.Contains(err.Error(), "delete_local_user") {
+		t.Errorf("Expected the mutating script to be rejected, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package jenkins
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -17,6 +18,15 @@ func resourceAuthorizationGlobalMatrix() *schema.Resource {
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
+		CustomizeDiff: requireCapabilities("jenkins_authorization_global_matrix", jenkinsRequirements{
+			plugins: []string{"matrix-auth"},
+		}),
 		Schema: resourceAuthorizationGlobalMatrixSchema,
 	}
 }
@@ -28,9 +38,9 @@ func resourceAuthorizationGlobalMatrixCreate(ctx context.Context, d *schema.Reso
 	permsSet := d.Get("permissions").(*schema.Set)
 	permissions := converSetToSliceStr(permsSet)
 
-	err := client.CreateUserPermissions(username, permissions)
+	err := client.CreateUserPermissions(ctx, username, permissions)
 	if err != nil {
-		diag.FromErr(err)
+		return diag.FromErr(err)
 	}
 
 	d.SetId(username)
@@ -42,7 +52,7 @@ func resourceAuthorizationGlobalMatrixRead(ctx context.Context, d *schema.Resour
 	client := m.(jenkinsClient)
 
 	username := d.Id()
-	userPermission, err := client.GetUserPermissions(username)
+	userPermission, err := client.GetUserPermissions(ctx, username)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -65,9 +75,9 @@ func resourceAuthorizationGlobalMatrixUpdate(ctx context.Context, d *schema.Reso
 	permsSet := d.Get("permissions").(*schema.Set)
 	permissions := converSetToSliceStr(permsSet)
 
-	err := client.UpdateUserPermissions(username, permissions)
+	err := client.UpdateUserPermissions(ctx, username, permissions)
 	if err != nil {
-		diag.FromErr(err)
+		return diag.FromErr(err)
 	}
 
 	d.SetId(username)
@@ -78,7 +88,7 @@ func resourceAuthorizationGlobalMatrixDelete(ctx context.Context, d *schema.Reso
 	client := m.(jenkinsClient)
 
 	username := d.Id()
-	err := client.DeleteUserPermissions(username)
+	err := client.DeleteUserPermissions(ctx, username)
 	if err != nil {
 		return diag.FromErr(err)
 	}
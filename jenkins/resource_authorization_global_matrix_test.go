@@ -0,0 +1,62 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func testGlobalMatrixData(t *testing.T) *schema.ResourceData {
+	t.Helper()
+
+	d := schema.TestResourceDataRaw(t, resourceAuthorizationGlobalMatrix().Schema, map[string]interface{}{
+		"username":    "alice",
+		"permissions": []interface{}{"Overall/Read"},
+	})
+	d.SetId("alice")
+	return d
+}
+
+func TestResourceAuthorizationGlobalMatrix_readOnly(t *testing.T) {
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected script sent: %s", r.FormValue("script"))
+	})
+	adapter := newTestClient(t, server)
+	adapter.config.ReadOnly = true
+	client := readOnlyClient{adapter}
+
+	if diags := resourceAuthorizationGlobalMatrixCreate(context.Background(), testGlobalMatrixData(t), client); !diags.HasError() {
+		t.Errorf("Expected the creation to fail in read-only mode")
+	}
+	if diags := resourceAuthorizationGlobalMatrixUpdate(context.Background(), testGlobalMatrixData(t), client); !diags.HasError() {
+		t.Errorf("Expected the update to fail in read-only mode")
+	}
+}
+
+func TestResourceAuthorizationGlobalMatrix_errorCodes(t *testing.T) {
+	cases := map[string]error{
+		codePreconditionFailed: errPreconditionFailed,
+		codePluginMissing:      errPluginMissing,
+	}
+	for code, expected := range cases {
+		server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"error": true, "code": "` + code + `", "msg": "Jenkins is not using the matrix authorization strategy", "data": {}}`))
+		})
+		client := newTestClient(t, server)
+
+		if err := client.CreateUserPermissions(context.Background(), "alice", []string{"Overall/Read"}); !errors.Is(err, expected) {
+			t.Errorf("Expected a %s error, got %v", code, err)
+		}
+		diags := resourceAuthorizationGlobalMatrixCreate(context.Background(), testGlobalMatrixData(t), client)
+		if !diags.HasError() || diags[0].Summary != "Jenkins is not using the matrix authorization strategy" {
+			t.Errorf("Expected the %s error to be reported, got %v", code, diags)
+		}
+		diags = resourceAuthorizationGlobalMatrixUpdate(context.Background(), testGlobalMatrixData(t), client)
+		if !diags.HasError() || diags[0].Summary != "Jenkins is not using the matrix authorization strategy" {
+			t.Errorf("Expected the %s error to be reported, got %v", code, diags)
+		}
+	}
+}
@@ -2,11 +2,26 @@ package jenkins
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
+// managedByTerraformDescription is the description given to local users created
+// without an explicit one. It marks users as owned by this provider.
+const managedByTerraformDescription = "Managed by Terraform"
+
+// localUserRequirements are needed by the local user scripts, user seeds appeared in Jenkins 2.160
+var localUserRequirements = jenkinsRequirements{
+	minVersion: "2.160",
+	plugins:    []string{"mailer"},
+}
+
 func resourceLocalUser() *schema.Resource {
 	return &schema.Resource{
 		CreateContext: resourceLocalUserCreate,
@@ -16,7 +31,14 @@ func resourceLocalUser() *schema.Resource {
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
-		Schema: resourceLocalUserSchema,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
+		CustomizeDiff: resourceLocalUserCustomizeDiff,
+		Schema:        resourceLocalUserSchema,
 	}
 }
 
@@ -29,16 +51,20 @@ func resourceLocalUserCreate(ctx context.Context, d *schema.ResourceData, m inte
 	fullname := d.Get("fullname").(string)
 	description := d.Get("description").(string)
 
-	user, err := client.GetLocalUser(username)
-	if err != nil {
+	_, err := client.GetLocalUser(ctx, username)
+	if err == nil {
+		return diag.Errorf("Local user %s is already existing in the Jenkins system", username)
+	}
+	if !errors.Is(err, errNotFound) {
 		return diag.FromErr(err)
 	}
 
-	if user.Username != "" {
-		return diag.Errorf("Local user %s is already existing in the Jenkins system", username)
+	err = client.CreateLocalUser(ctx, username, password, fullname, email, description)
+	if err != nil {
+		return diag.FromErr(err)
 	}
 
-	err = client.CreateLocalUser(username, password, fullname, email, description)
+	err = client.UpdateLocalUserProperties(ctx, expandLocalUserProperties(d))
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -53,7 +79,12 @@ func resourceLocalUserRead(ctx context.Context, d *schema.ResourceData, m interf
 
 	username := d.Id()
 
-	user, err := client.GetLocalUser(username)
+	user, err := client.GetLocalUser(ctx, username)
+	if errors.Is(err, errNotFound) {
+		log.Printf("[WARN] Local user %s not found, removing it from state", username)
+		d.SetId("")
+		return diags
+	}
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -78,6 +109,40 @@ func resourceLocalUserRead(ctx context.Context, d *schema.ResourceData, m interf
 		return diag.FromErr(err)
 	}
 
+	if err := d.Set("timezone", user.Timezone); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set("primary_view", user.PrimaryView); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Like the generic properties, the SSH keys are only read back once managed by Terraform,
+	// so the keys added by the user are kept while the configuration sets none
+	if len(d.Get("ssh_public_keys").([]interface{})) > 0 {
+		if err := d.Set("ssh_public_keys", user.SSHPublicKeys); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// Only the generic properties managed by Terraform are read back
+	configured := expandLocalUserProperties(d).Properties
+	if len(configured) > 0 {
+		classes := make([]string, len(configured))
+		for i, property := range configured {
+			classes[i] = property.Class
+		}
+
+		properties, err := client.GetLocalUserProperties(ctx, username, classes)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if err := d.Set("property", flattenLocalUserProperties(properties, configured)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
 	return diags
 }
 
@@ -90,12 +155,128 @@ func resourceLocalUserUpdate(ctx context.Context, d *schema.ResourceData, m inte
 	fullname := d.Get("fullname").(string)
 	description := d.Get("description").(string)
 
-	err := client.CreateLocalUser(username, password, fullname, email, description)
+	err := client.CreateLocalUser(ctx, username, password, fullname, email, description)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	return resourceLocalUserRead(ctx, d, m)
+	if d.HasChanges("timezone", "primary_view", "ssh_public_keys", "property") {
+		properties := expandLocalUserProperties(d)
+		if d.HasChange("property") {
+			old, _ := d.GetChange("property")
+			for _, v := range old.([]interface{}) {
+				class := v.(map[string]interface{})["class"].(string)
+				if !hasLocalUserProperty(properties.Properties, class) {
+					properties.RemovedProperties = append(properties.RemovedProperties, class)
+				}
+			}
+		}
+
+		err = client.UpdateLocalUserProperties(ctx, properties)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// End the existing sessions, they may belong to whoever knew the previous password.
+	// A password change is still applied when they cannot be ended, an explicit rotation fails.
+	var diags diag.Diagnostics
+	if d.HasChange("password") || d.HasChange("rotate_seed") {
+		err = client.RenewLocalUserSeed(ctx, username)
+		if errors.Is(err, errSeedNotRenewed) && !d.HasChange("rotate_seed") {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("The existing sessions of %s are kept after changing the password", username),
+				Detail:   err.Error(),
+			})
+		} else if err != nil {
+			// Keep the previous rotate_seed, so the rotation is tried again by the next apply
+			previous, _ := d.GetChange("rotate_seed")
+			if err := d.Set("rotate_seed", previous); err != nil {
+				return diag.FromErr(err)
+			}
+			return diag.FromErr(err)
+		}
+	}
+
+	return append(diags, resourceLocalUserRead(ctx, d, m)...)
+}
+
+// resourceLocalUserCustomizeDiff catches at plan time the users that already exist,
+// including the ones only differing by case under a case-insensitive ID strategy
+func resourceLocalUserCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	client := m.(jenkinsClient)
+
+	capabilities, err := client.GetCapabilities(withPlanning(ctx))
+	if errors.Is(err, errProviderConfigUnknown) {
+		// Checked again once the provider configuration is known
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	requirements := localUserRequirements
+	requirements.plugins = append([]string{}, localUserRequirements.plugins...)
+	if len(d.Get("ssh_public_keys").([]interface{})) > 0 {
+		requirements.plugins = append(requirements.plugins, "sshd")
+	}
+	if len(d.Get("property").([]interface{})) > 0 {
+		requirements.plugins = append(requirements.plugins, "structs")
+	}
+	if err := capabilities.check("jenkins_local_user", requirements); err != nil {
+		return err
+	}
+	if usesJCasC(client) {
+		if err := checkLocalUserJCasC(d); err != nil {
+			return err
+		}
+	}
+
+	if d.Id() != "" && !d.HasChange("username") {
+		return nil
+	}
+	if !d.NewValueKnown("username") {
+		return nil
+	}
+
+	username := d.Get("username").(string)
+
+	// Jenkins resolves the user ID with its ID strategy
+	user, err := client.GetLocalUser(ctx, username)
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if d.Id() != "" && strings.EqualFold(d.Id(), user.Username) {
+		// Renaming the user to another case of its name
+		return nil
+	}
+	if user.Username != username {
+		return fmt.Errorf("Local user %s collides with existing local user %s, Jenkins user IDs are case-insensitive", username, user.Username)
+	}
+	return fmt.Errorf("Local user %s is already existing in the Jenkins system", username)
+}
+
+// checkLocalUserJCasC reports at plan time the changes configuration as code cannot make.
+// Deleting the user is only reported when applying: when the resource is removed from the configuration,
+// the plugin SDK plans its destruction without running CustomizeDiff, so there is no diff to check here.
+func checkLocalUserJCasC(d *schema.ResourceDiff) error {
+	username := d.Get("username").(string)
+	if d.Id() != "" && d.HasChange("username") {
+		return scriptAccessRequired(fmt.Sprintf("Replacing local user %s, which deletes it,", d.Id()))
+	}
+	if d.Id() != "" && d.HasChange("rotate_seed") {
+		return scriptAccessRequired(fmt.Sprintf("Renewing the seed of local user %s", username))
+	}
+	for _, key := range []string{"timezone", "primary_view", "ssh_public_keys", "property"} {
+		if d.HasChange(key) {
+			return scriptAccessRequired(fmt.Sprintf("Setting %s of local user %s", key, username))
+		}
+	}
+	return nil
 }
 
 func resourceLocalUserDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
@@ -103,7 +284,11 @@ func resourceLocalUserDelete(ctx context.Context, d *schema.ResourceData, m inte
 	var diags diag.Diagnostics
 
 	username := d.Id()
-	err := client.DeleteLocalUser(username)
+	err := client.DeleteLocalUser(ctx, username)
+	if errors.Is(err, errNotFound) {
+		// Already deleted outside of Terraform
+		return diags
+	}
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -111,11 +296,79 @@ func resourceLocalUserDelete(ctx context.Context, d *schema.ResourceData, m inte
 	return diags
 }
 
+// expandLocalUserProperties returns the properties of the configuration. Only the attributes
+// that changed are set, so the values set in Jenkins outside of Terraform are kept.
+func expandLocalUserProperties(d *schema.ResourceData) jenkinsLocalUserProperties {
+	properties := jenkinsLocalUserProperties{
+		Username:   d.Get("username").(string),
+		Properties: []jenkinsUserProperty{},
+	}
+
+	if d.HasChange("timezone") {
+		timezone := d.Get("timezone").(string)
+		properties.Timezone = &timezone
+	}
+	if d.HasChange("primary_view") {
+		primaryView := d.Get("primary_view").(string)
+		properties.PrimaryView = &primaryView
+	}
+	if d.HasChange("ssh_public_keys") {
+		keys := []string{}
+		for _, v := range d.Get("ssh_public_keys").([]interface{}) {
+			keys = append(keys, v.(string))
+		}
+		properties.SSHPublicKeys = &keys
+	}
+
+	for _, v := range d.Get("property").([]interface{}) {
+		block := v.(map[string]interface{})
+		property := jenkinsUserProperty{
+			Class:     block["class"].(string),
+			Arguments: map[string]string{},
+		}
+		for name, value := range block["arguments"].(map[string]interface{}) {
+			property.Arguments[name] = value.(string)
+		}
+		properties.Properties = append(properties.Properties, property)
+	}
+
+	return properties
+}
+
+// flattenLocalUserProperties keeps the arguments set in the configuration, so arguments
+// Jenkins reports but Terraform does not manage are not seen as drift
+func flattenLocalUserProperties(properties []jenkinsUserProperty, configured []jenkinsUserProperty) []interface{} {
+	result := make([]interface{}, len(properties))
+	for i, property := range properties {
+		arguments := map[string]interface{}{}
+		for name, value := range property.Arguments {
+			if _, ok := configured[i].Arguments[name]; ok {
+				arguments[name] = value
+			}
+		}
+		result[i] = map[string]interface{}{
+			"class":     property.Class,
+			"arguments": arguments,
+		}
+	}
+	return result
+}
+
+func hasLocalUserProperty(properties []jenkinsUserProperty, class string) bool {
+	for _, property := range properties {
+		if property.Class == class {
+			return true
+		}
+	}
+	return false
+}
+
 var resourceLocalUserSchema = map[string]*schema.Schema{
 	"email": {
-		Type:        schema.TypeString,
-		Required:    true,
-		Description: "Email address of the Jenkins local user",
+		Type:         schema.TypeString,
+		Required:     true,
+		ValidateFunc: validateEmail,
+		Description:  "Email address of the Jenkins local user",
 	},
 	"fullname": {
 		Type:        schema.TypeString,
@@ -134,15 +387,61 @@ var resourceLocalUserSchema = map[string]*schema.Schema{
 		Description: "Password hash of the jenkins local user",
 	},
 	"username": {
-		Type:        schema.TypeString,
-		Required:    true,
-		ForceNew:    true,
-		Description: "Username of the Jenkins local user",
+		Type:         schema.TypeString,
+		Required:     true,
+		ForceNew:     true,
+		ValidateFunc: validateLocalUsername,
+		Description:  "Username of the Jenkins local user",
 	},
 	"description": {
 		Type:        schema.TypeString,
 		Optional:    true,
-		Default:     "Managed by Terraform",
+		Default:     managedByTerraformDescription,
 		Description: "Description of the Jenkins local user",
 	},
+	"rotate_seed": {
+		Type:        schema.TypeString,
+		Optional:    true,
+		Description: "Arbitrary value, changing it renews the user seed which ends all sessions of the Jenkins local user",
+	},
+	"timezone": {
+		Type:        schema.TypeString,
+		Optional:    true,
+		Description: "Time zone of the Jenkins local user, e.g. Europe/Paris. The time zone of Jenkins is used when unset",
+	},
+	"primary_view": {
+		Type:        schema.TypeString,
+		Optional:    true,
+		Description: "Name of the default view of the Jenkins local user. The all view is used when unset",
+	},
+	"ssh_public_keys": {
+		Type:        schema.TypeList,
+		Optional:    true,
+		Description: "SSH public keys of the Jenkins local user, used by the sshd plugin. The keys added by the user are kept when none was ever set, removing the keys set clears them",
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	},
+	"property": {
+		Type:        schema.TypeList,
+		Optional:    true,
+		Description: "Generic user property of the Jenkins local user. Requires the structs plugin",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"class": {
+					Type:        schema.TypeString,
+					Required:    true,
+					Description: "Fully qualified class name of the user property",
+				},
+				"arguments": {
+					Type:        schema.TypeMap,
+					Optional:    true,
+					Description: "Arguments of the user property, as accepted by its data bound constructor and setters",
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+			},
+		},
+	},
 }
@@ -0,0 +1,313 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// testLocalUserData returns the data of a local user being updated from the state to the configuration
+func testLocalUserData(t *testing.T, state map[string]string, raw map[string]interface{}) *schema.ResourceData {
+	t.Helper()
+
+	schemaMap := schema.InternalMap(resourceLocalUser().Schema)
+	instanceState := &terraform.InstanceState{ID: state["username"], Attributes: state}
+	diff, err := schemaMap.Diff(context.Background(), instanceState, terraform.NewResourceConfigRaw(raw), nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := schemaMap.Data(instanceState, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+var testLocalUserState = map[string]string{
+	"username":          "alice",
+	"password":          "alicepwd",
+	"email":             "alice@example.com",
+	"fullname":          "Alice",
+	"description":       managedByTerraformDescription,
+	"timezone":          "Europe/Paris",
+	"primary_view":      "builds",
+	"ssh_public_keys.#": "1",
+	"ssh_public_keys.0": "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIA alice@laptop",
+	"property.#":        "0",
+}
+
+func testLocalUserConfig(attributes map[string]interface{}) map[string]interface{} {
+	raw := map[string]interface{}{
+		"username": "alice",
+		"password": "alicepwd",
+		"email":    "alice@example.com",
+		"fullname": "Alice",
+	}
+	for name, value := range attributes {
+		raw[name] = value
+	}
+	return raw
+}
+
+func TestExpandLocalUserProperties_create(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLocalUser().Schema, testLocalUserConfig(map[string]interface{}{
+		"timezone": "UTC",
+		"property": []interface{}{
+			map[string]interface{}{
+				"class":     "hudson.tasks.Mailer$UserProperty",
+				"arguments": map[string]interface{}{"emailAddress": "alice@example.com"},
+			},
+		},
+	}))
+
+	properties := expandLocalUserProperties(d)
+	if properties.Timezone == nil || *properties.Timezone != "UTC" {
+		t.Errorf("Expected the time zone to be set, got %v", properties.Timezone)
+	}
+	if properties.PrimaryView != nil {
+		t.Errorf("Expected the unset primary view not to be sent, got %v", *properties.PrimaryView)
+	}
+	if properties.SSHPublicKeys != nil {
+		t.Errorf("Expected the unset SSH keys not to be sent, got %v", *properties.SSHPublicKeys)
+	}
+	expected := []jenkinsUserProperty{
+		{Class: "hudson.tasks.Mailer$UserProperty", Arguments: map[string]string{"emailAddress": "alice@example.com"}},
+	}
+	if !reflect.DeepEqual(properties.Properties, expected) {
+		t.Errorf("Expected properties %v, got %v", expected, properties.Properties)
+	}
+}
+
+func TestExpandLocalUserProperties_update(t *testing.T) {
+	// The keys added by the user are not read back, the time zone removed from the configuration is cleared
+	state := map[string]string{}
+	for name, value := range testLocalUserState {
+		state[name] = value
+	}
+	state["ssh_public_keys.#"] = "0"
+	delete(state, "ssh_public_keys.0")
+
+	d := testLocalUserData(t, state, testLocalUserConfig(map[string]interface{}{
+		"primary_view": "builds",
+	}))
+
+	properties := expandLocalUserProperties(d)
+	if properties.SSHPublicKeys != nil {
+		t.Errorf("Expected the SSH keys of the user to be kept, got %v", *properties.SSHPublicKeys)
+	}
+	if properties.Timezone == nil || *properties.Timezone != "" {
+		t.Errorf("Expected the time zone to be cleared, got %v", properties.Timezone)
+	}
+	if properties.PrimaryView != nil {
+		t.Errorf("Expected the unchanged primary view not to be sent, got %v", *properties.PrimaryView)
+	}
+
+	d = testLocalUserData(t, testLocalUserState, testLocalUserConfig(map[string]interface{}{
+		"timezone":        "Europe/Paris",
+		"primary_view":    "builds",
+		"ssh_public_keys": []interface{}{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIB alice@desktop"},
+	}))
+
+	properties = expandLocalUserProperties(d)
+	if properties.SSHPublicKeys == nil || !reflect.DeepEqual(*properties.SSHPublicKeys, []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIB alice@desktop"}) {
+		t.Errorf("Expected the configured SSH keys to be sent, got %v", properties.SSHPublicKeys)
+	}
+	if properties.Timezone != nil {
+		t.Errorf("Expected the unchanged time zone not to be sent, got %v", *properties.Timezone)
+	}
+}
+
+func TestExpandLocalUserProperties_clearsSSHKeys(t *testing.T) {
+	configs := map[string]map[string]interface{}{
+		"removed": testLocalUserConfig(map[string]interface{}{
+			"timezone":     "Europe/Paris",
+			"primary_view": "builds",
+		}),
+		"empty": testLocalUserConfig(map[string]interface{}{
+			"timezone":        "Europe/Paris",
+			"primary_view":    "builds",
+			"ssh_public_keys": []interface{}{},
+		}),
+	}
+	for name, raw := range configs {
+		properties := expandLocalUserProperties(testLocalUserData(t, testLocalUserState, raw))
+		if properties.SSHPublicKeys == nil || len(*properties.SSHPublicKeys) != 0 {
+			t.Errorf("Expected the %s SSH keys to be cleared, got %v", name, properties.SSHPublicKeys)
+		}
+	}
+}
+
+func TestFlattenLocalUserProperties(t *testing.T) {
+	properties := []jenkinsUserProperty{
+		{Class: "hudson.tasks.Mailer$UserProperty", Arguments: map[string]string{"emailAddress": "alice@example.com", "other": "x"}},
+		{Class: "hudson.model.PaneStatusProperties", Arguments: map[string]string{}},
+	}
+	configured := []jenkinsUserProperty{
+		{Class: "hudson.tasks.Mailer$UserProperty", Arguments: map[string]string{"emailAddress": "bob@example.com"}},
+		{Class: "hudson.model.PaneStatusProperties", Arguments: map[string]string{"collapsed": "true"}},
+	}
+
+	expected := []interface{}{
+		map[string]interface{}{
+			"class":     "hudson.tasks.Mailer$UserProperty",
+			"arguments": map[string]interface{}{"emailAddress": "alice@example.com"},
+		},
+		map[string]interface{}{
+			"class":     "hudson.model.PaneStatusProperties",
+			"arguments": map[string]interface{}{},
+		},
+	}
+	if actual := flattenLocalUserProperties(properties, configured); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected only the configured arguments %v, got %v", expected, actual)
+	}
+}
+
+func TestHasLocalUserProperty(t *testing.T) {
+	properties := []jenkinsUserProperty{{Class: "hudson.tasks.Mailer$UserProperty"}}
+
+	if !hasLocalUserProperty(properties, "hudson.tasks.Mailer$UserProperty") {
+		t.Errorf("Expected the mailer property to be found")
+	}
+	if hasLocalUserProperty(properties, "hudson.model.PaneStatusProperties") {
+		t.Errorf("Expected the pane status property not to be found")
+	}
+	if hasLocalUserProperty(nil, "hudson.tasks.Mailer$UserProperty") {
+		t.Errorf("Expected no property to be found without properties")
+	}
+}
+
+func TestResourceLocalUserUpdate_renewsSeed(t *testing.T) {
+	for _, seedsDisabled := range []bool{false, true} {
+		stub := &localUsersStub{users: []string{"alice"}, seedsDisabled: seedsDisabled}
+		client := newTestClient(t, newJenkinsStub(t, stub.handle))
+
+		d := testLocalUserData(t, testLocalUserState, testLocalUserConfig(map[string]interface{}{
+			"password":     "newalicepwd",
+			"timezone":     "Europe/Paris",
+			"primary_view": "builds",
+		}))
+		diags := resourceLocalUserUpdate(context.Background(), d, client)
+		if diags.HasError() {
+			t.Fatalf("Unexpected error with seeds disabled %t: %v", seedsDisabled, diags)
+		}
+		if warned := len(diags) == 1 && diags[0].Severity == diag.Warning; warned != seedsDisabled {
+			t.Errorf("Expected a warning %t about the kept sessions with seeds disabled %t, got %v", seedsDisabled, seedsDisabled, diags)
+		}
+
+		renewed := false
+		for _, script := range stub.ran() {
+			renewed = renewed || script == "renew_local_user_seed"
+		}
+		if !renewed {
+			t.Errorf("Expected a password change to renew the seed with seeds disabled %t, got scripts %v", seedsDisabled, stub.ran())
+		}
+	}
+}
+
+func TestResourceLocalUserUpdate_rotateSeedDisabled(t *testing.T) {
+	stub := &localUsersStub{users: []string{"alice"}, seedsDisabled: true}
+	client := newTestClient(t, newJenkinsStub(t, stub.handle))
+
+	d := testLocalUserData(t, testLocalUserState, testLocalUserConfig(map[string]interface{}{
+		"timezone":     "Europe/Paris",
+		"primary_view": "builds",
+		"rotate_seed":  "1",
+	}))
+	if diags := resourceLocalUserUpdate(context.Background(), d, client); !diags.HasError() {
+		t.Errorf("Expected an explicit seed rotation to fail with seeds disabled, got %v", diags)
+	}
+	if rotateSeed := d.Get("rotate_seed").(string); rotateSeed != "" {
+		t.Errorf("Expected the failed rotation to be tried again, got rotate_seed %q", rotateSeed)
+	}
+}
+
+func TestResourceLocalUserUpdate_seedFailure(t *testing.T) {
+	stub := &localUsersStub{users: []string{"alice"}}
+	server := newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.FormValue("script"), "script=renew_local_user_seed") {
+			w.Write([]byte(`{"error": true, "code": "precondition_failed", "msg": "Jenkins is not using local user database", "data": {}}`))
+			return
+		}
+		stub.handle(w, r)
+	})
+	client := newTestClient(t, server)
+
+	d := testLocalUserData(t, testLocalUserState, testLocalUserConfig(map[string]interface{}{
+		"password":     "newalicepwd",
+		"timezone":     "Europe/Paris",
+		"primary_view": "builds",
+	}))
+	if diags := resourceLocalUserUpdate(context.Background(), d, client); !diags.HasError() {
+		t.Errorf("Expected a failed seed renewal to be reported")
+	}
+}
+
+// testLocalUserPlan plans the change of a local user from the state to the configuration
+func testLocalUserPlan(t *testing.T, state map[string]string, raw map[string]interface{}, m interface{}) error {
+	t.Helper()
+
+	var instanceState *terraform.InstanceState
+	if state != nil {
+		instanceState = &terraform.InstanceState{ID: state["username"], Attributes: state}
+	}
+	_, err := schema.InternalMap(resourceLocalUser().Schema).Diff(context.Background(), instanceState, terraform.NewResourceConfigRaw(raw), resourceLocalUserCustomizeDiff, m, false)
+	return err
+}
+
+func TestResourceLocalUserCustomizeDiff_existingUser(t *testing.T) {
+	stub := &localUsersStub{users: []string{"Alice"}}
+	client := newTestClient(t, newJenkinsStub(t, stub.handle))
+
+	err := testLocalUserPlan(t, nil, testLocalUserConfig(nil), client)
+	if err == nil || !strings.Contains(err.Error(), "collides with existing local user Alice") {
+		t.Errorf("Expected a collision with Alice, got %v", err)
+	}
+
+	err = testLocalUserPlan(t, nil, testLocalUserConfig(map[string]interface{}{"username": "Alice"}), client)
+	if err == nil || !strings.Contains(err.Error(), "already existing") {
+		t.Errorf("Expected Alice to be already existing, got %v", err)
+	}
+}
+
+func TestResourceLocalUserCustomizeDiff_renameCase(t *testing.T) {
+	stub := &localUsersStub{users: []string{"Alice"}}
+	client := newTestClient(t, newJenkinsStub(t, stub.handle))
+
+	state := map[string]string{}
+	for name, value := range testLocalUserState {
+		state[name] = value
+	}
+	state["username"] = "Alice"
+	state["ssh_public_keys.#"] = "0"
+	delete(state, "ssh_public_keys.0")
+
+	if err := testLocalUserPlan(t, state, testLocalUserConfig(map[string]interface{}{
+		"timezone":     "Europe/Paris",
+		"primary_view": "builds",
+	}), client); err != nil {
+		t.Errorf("Expected renaming Alice to alice to be planned, got %v", err)
+	}
+}
+
+func TestResourceLocalUserCustomizeDiff_requirements(t *testing.T) {
+	stub := &localUsersStub{}
+	client := newTestClient(t, newJenkinsStub(t, stub.handle))
+
+	err := testLocalUserPlan(t, nil, testLocalUserConfig(map[string]interface{}{
+		"ssh_public_keys": []interface{}{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIB alice@desktop"},
+	}), client)
+	if !errors.Is(err, errPluginMissing) {
+		t.Errorf("Expected SSH keys to require the sshd plugin, got %v", err)
+	}
+	if !reflect.DeepEqual(localUserRequirements.plugins, []string{"mailer"}) {
+		t.Errorf("Expected the local user requirements to be left untouched, got %v", localUserRequirements.plugins)
+	}
+}
@@ -0,0 +1,225 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// localUsersExclusiveID is the ID of the jenkins_local_users_exclusive resource.
+// There is only one local user database per Jenkins system.
+const localUsersExclusiveID = "local_users"
+
+func resourceLocalUsersExclusive() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceLocalUsersExclusiveCreate,
+		ReadContext:   resourceLocalUsersExclusiveRead,
+		UpdateContext: resourceLocalUsersExclusiveUpdate,
+		DeleteContext: resourceLocalUsersExclusiveDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceLocalUsersExclusiveImport,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
+		CustomizeDiff: resourceLocalUsersExclusiveCustomizeDiff,
+		Schema:        resourceLocalUsersExclusiveSchema,
+	}
+}
+
+func resourceLocalUsersExclusiveCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	deleted, err := deleteUnmanagedLocalUsers(ctx, d, m.(jenkinsClient))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(localUsersExclusiveID)
+	if err := d.Set("deleted_usernames", deleted); err != nil {
+		return diag.FromErr(err)
+	}
+	return resourceLocalUsersExclusiveRead(ctx, d, m)
+}
+
+func resourceLocalUsersExclusiveRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(jenkinsClient)
+
+	strays, err := unmanagedLocalUsers(ctx, client, d.Get("usernames").(*schema.Set), d.Get("exempt_usernames").(*schema.Set))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Keep the allowed usernames and add the strays, so the plan shows them being removed
+	usernames := d.Get("usernames").(*schema.Set)
+	for _, username := range strays {
+		usernames.Add(username)
+	}
+
+	if err := d.Set("usernames", usernames); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func resourceLocalUsersExclusiveUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	if _, err := deleteUnmanagedLocalUsers(ctx, d, m.(jenkinsClient)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return resourceLocalUsersExclusiveRead(ctx, d, m)
+}
+
+// resourceLocalUsersExclusiveImport allows the existing local users, so importing deletes none of them
+func resourceLocalUsersExclusiveImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	if d.Id() != localUsersExclusiveID {
+		return nil, fmt.Errorf("Unexpected ID %s, exclusive management of local users is imported with the %s ID", d.Id(), localUsersExclusiveID)
+	}
+
+	users, err := m.(jenkinsClient).GetLocalUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usernames := make([]interface{}, len(users))
+	for i, user := range users {
+		usernames[i] = user.Username
+	}
+	if err := d.Set("usernames", usernames); err != nil {
+		return nil, err
+	}
+
+	return []*schema.ResourceData{d}, nil
+}
+
+// resourceLocalUsersExclusiveCustomizeDiff shows in the plan the local users deleted when creating the resource,
+// which are not in the state yet, and reports the deletions configuration as code cannot make
+func resourceLocalUsersExclusiveCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	checkRequirements := requireCapabilities("jenkins_local_users_exclusive", jenkinsRequirements{
+		plugins: []string{"mailer"},
+	})
+	if err := checkRequirements(ctx, d, m); err != nil {
+		return err
+	}
+
+	client := m.(jenkinsClient)
+	created := d.Id() == ""
+	if !created && !usesJCasC(client) {
+		// Read adds the strays to usernames, so the plan already shows them being removed
+		return nil
+	}
+
+	if !d.NewValueKnown("usernames") || !d.NewValueKnown("exempt_usernames") {
+		if created {
+			return d.SetNewComputed("deleted_usernames")
+		}
+		return nil
+	}
+
+	strays, err := unmanagedLocalUsers(withPlanning(ctx), client, d.Get("usernames").(*schema.Set), d.Get("exempt_usernames").(*schema.Set))
+	if errors.Is(err, errProviderConfigUnknown) {
+		// Checked again once the provider configuration is known
+		if created {
+			return d.SetNewComputed("deleted_usernames")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(strays) > 0 && usesJCasC(client) {
+		return scriptAccessRequired(fmt.Sprintf("Deleting the unmanaged local users %s", strings.Join(strays, ", ")))
+	}
+	if created {
+		return d.SetNew("deleted_usernames", strays)
+	}
+	return nil
+}
+
+func resourceLocalUsersExclusiveDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	// Stop enforcing exclusivity, users are left untouched
+	return nil
+}
+
+// unmanagedLocalUsers returns the local users that are neither allowed nor exempted.
+// The user the provider is authenticated as is always exempted. Like the default ID
+// strategy of Jenkins, usernames are compared case-insensitively.
+func unmanagedLocalUsers(ctx context.Context, client jenkinsClient, usernames *schema.Set, exemptUsernames *schema.Set) ([]string, error) {
+	users, err := client.GetLocalUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	currentUsername, err := client.GetCurrentUsername(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := map[string]bool{strings.ToLower(currentUsername): true}
+	for _, set := range []*schema.Set{usernames, exemptUsernames} {
+		for _, username := range set.List() {
+			kept[strings.ToLower(username.(string))] = true
+		}
+	}
+
+	var strays []string
+	for _, user := range users {
+		if kept[strings.ToLower(user.Username)] {
+			continue
+		}
+		strays = append(strays, user.Username)
+	}
+
+	return strays, nil
+}
+
+// deleteUnmanagedLocalUsers deletes the local users that are neither allowed nor exempted, and returns their usernames
+func deleteUnmanagedLocalUsers(ctx context.Context, d *schema.ResourceData, client jenkinsClient) ([]string, error) {
+	strays, err := unmanagedLocalUsers(ctx, client, d.Get("usernames").(*schema.Set), d.Get("exempt_usernames").(*schema.Set))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, username := range strays {
+		// A stray deleted meanwhile is already gone
+		if err := client.DeleteLocalUser(ctx, username); err != nil && !errors.Is(err, errNotFound) {
+			return nil, err
+		}
+	}
+
+	return strays, nil
+}
+
+var resourceLocalUsersExclusiveSchema = map[string]*schema.Schema{
+	"usernames": {
+		Type:        schema.TypeSet,
+		Required:    true,
+		Description: "Usernames of the Jenkins local users allowed to exist, any other local user is deleted",
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	},
+	"exempt_usernames": {
+		Type:        schema.TypeSet,
+		Optional:    true,
+		Description: "Usernames of the Jenkins local users that are never deleted. The user the provider authenticates as is always exempted",
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	},
+	"deleted_usernames": {
+		Type:        schema.TypeSet,
+		Computed:    true,
+		Description: "Usernames of the Jenkins local users deleted when the resource was created",
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	},
+}
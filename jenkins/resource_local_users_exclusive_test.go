@@ -0,0 +1,138 @@
+package jenkins
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestLocalUsersExclusive_deletesStrays(t *testing.T) {
+	cases := []struct {
+		name      string
+		raw       map[string]interface{}
+		remaining []string
+	}{
+		{
+			name:      "strays",
+			raw:       map[string]interface{}{"usernames": []interface{}{"alice"}},
+			remaining: []string{"admin", "alice"},
+		},
+		{
+			name:      "case mismatch",
+			raw:       map[string]interface{}{"usernames": []interface{}{"ALICE", "bob"}},
+			remaining: []string{"Bob", "admin", "alice"},
+		},
+		{
+			name: "exemptions",
+			raw: map[string]interface{}{
+				"usernames":        []interface{}{"alice"},
+				"exempt_usernames": []interface{}{"bob", "CAROL"},
+			},
+			remaining: []string{"Bob", "admin", "alice", "carol"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// The provider authenticates as Admin, listed in another case
+			stub := &localUsersStub{users: []string{"admin", "alice", "Bob", "carol"}, current: "Admin"}
+			client := newTestClient(t, newJenkinsStub(t, stub.handle))
+
+			d := schema.TestResourceDataRaw(t, resourceLocalUsersExclusive().Schema, c.raw)
+			if diags := resourceLocalUsersExclusiveCreate(context.Background(), d, client); diags.HasError() {
+				t.Fatalf("Unexpected error: %v", diags)
+			}
+
+			remaining := stub.remaining()
+			sort.Strings(remaining)
+			if !reflect.DeepEqual(remaining, c.remaining) {
+				t.Errorf("Expected users %v to remain, got %v", c.remaining, remaining)
+			}
+		})
+	}
+}
+
+func TestLocalUsersExclusive_readShowsStrays(t *testing.T) {
+	stub := &localUsersStub{users: []string{"admin", "Alice", "bob"}, current: "admin"}
+	client := newTestClient(t, newJenkinsStub(t, stub.handle))
+
+	d := schema.TestResourceDataRaw(t, resourceLocalUsersExclusive().Schema, map[string]interface{}{
+		"usernames": []interface{}{"alice"},
+	})
+	d.SetId(localUsersExclusiveID)
+	if diags := resourceLocalUsersExclusiveRead(context.Background(), d, client); diags.HasError() {
+		t.Fatalf("Unexpected error: %v", diags)
+	}
+
+	usernames := d.Get("usernames").(*schema.Set)
+	if usernames.Len() != 2 || !usernames.Contains("alice") || !usernames.Contains("bob") {
+		t.Errorf("Expected only bob to be added as a stray, got %v", usernames.List())
+	}
+	for _, name := range stub.ran() {
+		if name == "delete_local_user" {
+			t.Errorf("Expected reading to delete no user")
+		}
+	}
+}
+
+func TestLocalUsersExclusive_import(t *testing.T) {
+	stub := &localUsersStub{users: []string{"admin", "alice", "bob"}, current: "admin"}
+	client := newTestClient(t, newJenkinsStub(t, stub.handle))
+	importer := resourceLocalUsersExclusive().Importer
+
+	d := schema.TestResourceDataRaw(t, resourceLocalUsersExclusive().Schema, map[string]interface{}{})
+	d.SetId("users")
+	if _, err := importer.StateContext(context.Background(), d, client); err == nil {
+		t.Errorf("Expected an unexpected ID to be rejected")
+	}
+
+	d.SetId(localUsersExclusiveID)
+	imported, err := importer.StateContext(context.Background(), d, client)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if usernames := imported[0].Get("usernames").(*schema.Set); usernames.Len() != 3 {
+		t.Errorf("Expected every existing user to be allowed, got %v", usernames.List())
+	}
+}
+
+func TestLocalUsersExclusive_planShowsDeletions(t *testing.T) {
+	stub := &localUsersStub{users: []string{"admin", "Alice", "bob"}, current: "admin"}
+	client := newTestClient(t, newJenkinsStub(t, stub.handle))
+
+	schemaMap := schema.InternalMap(resourceLocalUsersExclusiveSchema)
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{"usernames": []interface{}{"alice"}})
+	diff, err := schemaMap.Diff(context.Background(), nil, config, resourceLocalUsersExclusiveCustomizeDiff, client, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d, err := schemaMap.Data(nil, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := d.Get("deleted_usernames").(*schema.Set)
+	if deleted.Len() != 1 || !deleted.Contains("bob") {
+		t.Errorf("Expected the plan to show bob being deleted, got %v", deleted.List())
+	}
+	for _, name := range stub.ran() {
+		if name == "delete_local_user" {
+			t.Errorf("Expected planning to delete no user")
+		}
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceLocalUsersExclusive().Schema, map[string]interface{}{
+		"usernames": []interface{}{"alice"},
+	})
+	if diags := resourceLocalUsersExclusiveCreate(context.Background(), d, client); diags.HasError() {
+		t.Fatalf("Unexpected error: %v", diags)
+	}
+	deleted = d.Get("deleted_usernames").(*schema.Set)
+	if deleted.Len() != 1 || !deleted.Contains("bob") {
+		t.Errorf("Expected bob to be recorded as deleted, got %v", deleted.List())
+	}
+}
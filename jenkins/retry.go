@@ -0,0 +1,126 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// startingPageMarkers are found in the pages Jenkins serves while it is starting or restarting.
+// No script runs while they are served.
+var startingPageMarkers = []string{
+	"Jenkins is getting ready to work",
+	"Please wait while Jenkins is restarting",
+	"Jenkins is restarting",
+}
+
+// retryPolicy retries the calls to Jenkins failing for transient reasons,
+// with exponential backoff and jitter between the attempts
+type retryPolicy struct {
+	maxRetries int
+	waitMin    time.Duration
+	waitMax    time.Duration
+}
+
+// scriptResult is the raw outcome of a script sent to Jenkins
+type scriptResult struct {
+	statusCode int
+	body       []byte
+}
+
+// retry runs the attempt until it succeeds, fails permanently or runs out of retries.
+// Failures that may have executed the script are only retried for idempotent scripts.
+func (p retryPolicy) retry(ctx context.Context, idempotent bool, attempt func() (scriptResult, error)) (scriptResult, error) {
+	for retries := 0; ; retries++ {
+		result, err := attempt()
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		reason, retryable := retryReason(result, err, idempotent)
+		if !retryable || retries >= p.maxRetries {
+			return result, err
+		}
+
+		wait := p.backoff(retries)
+		log.Printf("[DEBUG] Retrying call to Jenkins in %s (%d/%d): %s", wait, retries+1, p.maxRetries, reason)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the wait before the given retry, between half and all of the exponential delay
+func (p retryPolicy) backoff(retries int) time.Duration {
+	wait := p.waitMin
+	for i := 0; i < retries && wait < p.waitMax; i++ {
+		wait *= 2
+	}
+	if wait > p.waitMax {
+		wait = p.waitMax
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(wait-half)+1))
+}
+
+// retryReason tells whether a failed call is worth retrying, and why
+func retryReason(result scriptResult, err error, idempotent bool) (string, bool) {
+	if err != nil {
+		// The connection was never established, the script did not run
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return err.Error(), true
+		}
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return "", false
+		}
+		var scriptErr *sshScriptError
+		if errors.As(err, &scriptErr) {
+			return "", false
+		}
+		var redirectErr *redirectError
+		if errors.As(err, &redirectErr) {
+			return "", false
+		}
+		return err.Error(), idempotent
+	}
+
+	switch result.statusCode {
+	case http.StatusServiceUnavailable:
+		if isStartingPage(result.body) {
+			return "Jenkins is starting", true
+		}
+		return fmt.Sprintf("status code %d", result.statusCode), idempotent
+	case http.StatusTooManyRequests:
+		return fmt.Sprintf("status code %d", result.statusCode), true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return fmt.Sprintf("status code %d", result.statusCode), idempotent
+	}
+
+	return "", false
+}
+
+func isStartingPage(body []byte) bool {
+	content := string(body)
+	for _, marker := range startingPageMarkers {
+		if strings.Contains(content, marker) {
+			return true
+		}
+	}
+	return false
+}
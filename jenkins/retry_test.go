@@ -0,0 +1,109 @@
+package jenkins
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPostScript_retryWhileStarting(t *testing.T) {
+	var attempts int32
+	var calls int32
+	client := newTestClient(t, newJenkinsStub(t, countScripts(&calls, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("<html>Please wait while Jenkins is restarting...</html>"))
+			return
+		}
+		w.Write([]byte(`{"error": false, "msg": "", "data": {}}`))
+	})))
+
+	response := jenkinsResponse{}
+	if err := client.postScript(context.Background(), groovyScript{name: "test", idempotent: false}, nil, "println('')", &response); err != nil {
+		t.Fatalf("Expected mutation to succeed once Jenkins started, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
+
+func TestPostScript_retryIdempotentOnly(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, newJenkinsStub(t, countScripts(&calls, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})))
+
+	response := jenkinsResponse{}
+	if err := client.postScript(context.Background(), groovyScript{name: "test", idempotent: false}, nil, "println('')", &response); err == nil {
+		t.Fatalf("Expected mutation to fail")
+	}
+	if calls != 1 {
+		t.Errorf("Expected mutation not to be retried, got %d calls", calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	if err := client.postScript(context.Background(), groovyScript{name: "test", idempotent: true}, nil, "println('')", &response); err == nil {
+		t.Fatalf("Expected read to fail")
+	}
+	if calls != 4 {
+		t.Errorf("Expected read to be retried 3 times, got %d calls", calls)
+	}
+}
+
+func TestPostScript_retryCancelled(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, newJenkinsStub(t, countScripts(&calls, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("Jenkins is getting ready to work"))
+	})))
+	client.retry.waitMin = time.Hour
+	client.retry.waitMax = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	response := jenkinsResponse{}
+	if err := client.postScript(ctx, groovyScript{name: "test", idempotent: true}, nil, "println('')", &response); err == nil {
+		t.Fatalf("Expected cancelled call to fail")
+	}
+	if calls != 1 {
+		t.Errorf("Expected no retry after cancellation, got %d calls", calls)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := retryPolicy{maxRetries: 10, waitMin: time.Second, waitMax: 8 * time.Second}
+
+	for retries, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second} {
+		wait := policy.backoff(retries)
+		if wait < max/2 || wait > max {
+			t.Errorf("Expected wait of retry %d between %s and %s, got %s", retries, max/2, max, wait)
+		}
+	}
+}
+
+func TestPostScript_contextCancelsInFlightScript(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	client := newTestClient(t, newJenkinsStub(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	response := jenkinsResponse{}
+	if err := client.PostScript(ctx, *bytes.NewBufferString("sleep(60000)"), &response); err == nil {
+		t.Fatalf("Expected cancelled script to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected script to be abandoned on cancellation, took %s", elapsed)
+	}
+}
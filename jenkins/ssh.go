@@ -0,0 +1,184 @@
+package jenkins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshScriptCommand is the Jenkins CLI command running the script read from its standard input
+const sshScriptCommand = "groovy ="
+
+// sshTransport runs the scripts with the Jenkins CLI over SSH, for the controllers only
+// exposing their SSH port to automation. A script completing is reported with status 200,
+// like the script console.
+type sshTransport struct {
+	config *Config
+
+	mu           sync.Mutex
+	clientConfig *ssh.ClientConfig
+	client       *ssh.Client
+}
+
+// sshScriptError is a script that ran and failed. It is not retried, it would fail the same way.
+type sshScriptError struct {
+	status int
+	stderr string
+}
+
+func (e *sshScriptError) Error() string {
+	return fmt.Sprintf("Jenkins script failed with exit status %d: %s", e.status, e.stderr)
+}
+
+func (t *sshTransport) open(ctx context.Context) error {
+	if t.config.SSHAddress == "" {
+		return fmt.Errorf("ssh_address must be set with the ssh transport, in the provider configuration or with the JENKINS_SSH_ADDRESS environment variable")
+	}
+
+	clientConfig, err := newSSHClientConfig(t.config)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.clientConfig = clientConfig
+	t.mu.Unlock()
+
+	if _, err := t.dial(ctx); err != nil {
+		return fmt.Errorf("Unable to connect to Jenkins at %s: %v", t.config.SSHAddress, err)
+	}
+
+	return nil
+}
+
+// newSSHClientConfig authenticates with the private key of the user,
+// and only accepts the configured host key of Jenkins
+func newSSHClientConfig(c *Config) (*ssh.ClientConfig, error) {
+	switch {
+	case c.Username == "":
+		return nil, fmt.Errorf("username must be set to authenticate to Jenkins over SSH")
+	case c.SSHPrivateKey == "":
+		return nil, fmt.Errorf("ssh_private_key must be set to authenticate to Jenkins over SSH")
+	case c.SSHHostKey == "":
+		return nil, fmt.Errorf("ssh_host_key must be set to verify the Jenkins SSH server")
+	}
+
+	keyPEM, err := readPEM(c.SSHPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the SSH private key: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SSH private key: %v", err)
+	}
+
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(c.SSHHostKey))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid ssh_host_key, expecting a public key like \"ssh-ed25519 AAAA...\": %v", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            c.Username,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         c.ConnectTimeout,
+	}, nil
+}
+
+// dial returns the SSH connection to Jenkins, connecting again once it was lost
+func (t *sshTransport) dial(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	dialer := &net.Dialer{Timeout: t.config.ConnectTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", t.config.SSHAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, t.config.SSHAddress, t.clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t.client = ssh.NewClient(sshConn, chans, reqs)
+	return t.client, nil
+}
+
+// drop forgets a lost connection, the next script connects again
+func (t *sshTransport) drop(client *ssh.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == client {
+		t.client.Close()
+		t.client = nil
+	}
+}
+
+// sendScript runs the script in a new session of the shared SSH connection
+func (t *sshTransport) sendScript(ctx context.Context, script string) (scriptResult, error) {
+	client, err := t.dial(ctx)
+	if err != nil {
+		return scriptResult{}, err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		// The connection was lost, e.g. while Jenkins restarted
+		t.drop(client)
+		return scriptResult{}, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdin = strings.NewReader(script)
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(sshScriptCommand)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return scriptResult{}, ctx.Err()
+	case err := <-done:
+		if exitErr, ok := err.(*ssh.ExitError); ok {
+			return scriptResult{}, &sshScriptError{status: exitErr.ExitStatus(), stderr: strings.TrimSpace(stderr.String())}
+		}
+		if err != nil {
+			return scriptResult{}, err
+		}
+	}
+
+	return scriptResult{statusCode: http.StatusOK, body: stdout.Bytes()}, nil
+}
+
+// fetchCapabilities asks a script, the REST API is not reachable
+func (t *sshTransport) fetchCapabilities(ctx context.Context) (jenkinsCapabilities, error) {
+	result, err := t.sendScript(ctx, getCapabilitiesScript.command)
+	if err != nil {
+		return jenkinsCapabilities{}, fmt.Errorf("Error listing Jenkins plugins: %v", err)
+	}
+
+	capabilities := jenkinsCapabilities{}
+	if err := json.Unmarshal(result.body, &capabilities); err != nil {
+		return jenkinsCapabilities{}, fmt.Errorf("Unexpected response listing Jenkins plugins: %v", err)
+	}
+
+	return capabilities, nil
+}
@@ -0,0 +1,198 @@
+package jenkins
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshScriptHandler answers a script with its output, error output and exit status
+type sshScriptHandler func(script string) (string, string, uint32)
+
+// sshStub stands in for the SSH server of the Jenkins CLI. It accepts the admin user with
+// the client key, and hands the scripts sent to the groovy command to the handler.
+type sshStub struct {
+	address   string
+	hostKey   string
+	clientKey string
+	commands  int32
+}
+
+func newSSHStub(t *testing.T, handler sshScriptHandler) *sshStub {
+	_, hostPrivateKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientPublicKey, clientPrivateKey, _ := ed25519.GenerateKey(rand.Reader)
+	clientSSHKey, _ := ssh.NewPublicKey(clientPublicKey)
+	clientDER, err := x509.MarshalPKCS8PrivateKey(clientPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "admin" && bytes.Equal(key.Marshal(), clientSSHKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	stub := &sshStub{
+		address:   listener.Addr().String(),
+		hostKey:   string(ssh.MarshalAuthorizedKey(hostSigner.PublicKey())),
+		clientKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: clientDER})),
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn, serverConfig, handler)
+		}
+	}()
+
+	return stub
+}
+
+func (s *sshStub) serve(conn net.Conn, config *ssh.ServerConfig, handler sshScriptHandler) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+
+				command := struct{ Command string }{}
+				ssh.Unmarshal(req.Payload, &command)
+				atomic.AddInt32(&s.commands, 1)
+
+				if command.Command != sshScriptCommand {
+					channel.Stderr().Write([]byte("unexpected command " + command.Command))
+					channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{2}))
+					return
+				}
+
+				script, _ := ioutil.ReadAll(channel)
+				stdout, stderr, status := handler(string(script))
+				channel.Write([]byte(stdout))
+				channel.Stderr().Write([]byte(stderr))
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				return
+			}
+		}()
+	}
+}
+
+// transport connects the test client to the stand-in with the ssh transport
+func (s *sshStub) transport() testClientOption {
+	return func(c *Config) {
+		c.Transport = transportSSH
+		c.SSHAddress = s.address
+		c.SSHPrivateKey = s.clientKey
+		c.SSHHostKey = s.hostKey
+		c.Password = ""
+		c.ConnectTimeout = 5 * time.Second
+	}
+}
+
+func TestSSHTransport_runsScripts(t *testing.T) {
+	stub := newSSHStub(t, func(script string) (string, string, uint32) {
+		if strings.Contains(script, "pluginManager.plugins") {
+			return `{"version": "2.263.1", "plugins": {"mailer": "1.32"}}` + "\n", "", 0
+		}
+		return `{"error": false, "msg": "", "data": [{"username": "alice"}]}` + "\n", "", 0
+	})
+	client := newTestClient(t, nil, stub.transport())
+
+	capabilities, err := client.GetCapabilities(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if capabilities.Version != "2.263.1" || capabilities.Plugins["mailer"] != "1.32" {
+		t.Errorf("Unexpected capabilities: %v", capabilities)
+	}
+
+	users, err := client.GetLocalUsers(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(users) != 1 || users[0].Username != "alice" {
+		t.Errorf("Unexpected users: %v", users)
+	}
+}
+
+func TestSSHTransport_failedScriptIsNotRetried(t *testing.T) {
+	stub := newSSHStub(t, func(script string) (string, string, uint32) {
+		return "", "groovy.lang.MissingPropertyException: No such property: foo", 1
+	})
+	client := newTestClient(t, nil, stub.transport())
+
+	_, err := client.GetLocalUsers(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "MissingPropertyException") {
+		t.Fatalf("Expected the error output of the script, got %v", err)
+	}
+	if stub.commands != 1 {
+		t.Errorf("Expected a failed script to run once, got %d runs", stub.commands)
+	}
+}
+
+func TestSSHTransport_rejectsUnknownHostKey(t *testing.T) {
+	stub := newSSHStub(t, func(script string) (string, string, uint32) {
+		return "{}", "", 0
+	})
+	other := newSSHStub(t, func(script string) (string, string, uint32) {
+		return "{}", "", 0
+	})
+	stub.hostKey = other.hostKey
+	client := newTestClient(t, nil, stub.transport())
+
+	if _, err := client.GetLocalUsers(context.Background()); err == nil || !strings.Contains(err.Error(), "host key") {
+		t.Errorf("Expected an unknown host key to be rejected, got %v", err)
+	}
+	if stub.commands != 0 {
+		t.Errorf("Expected no script to run, got %d", stub.commands)
+	}
+}
@@ -0,0 +1,215 @@
+package jenkins
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jenkinsStubOption customizes a stand-in for a Jenkins controller
+type jenkinsStubOption func(s *jenkinsStubSetup)
+
+type jenkinsStubSetup struct {
+	mux     *http.ServeMux
+	handler http.Handler
+}
+
+// withStubEndpoint serves another endpoint of Jenkins
+func withStubEndpoint(pattern string, handler http.HandlerFunc) jenkinsStubOption {
+	return func(s *jenkinsStubSetup) {
+		s.mux.HandleFunc(pattern, handler)
+	}
+}
+
+// withStubProxy puts the stand-in behind a reverse proxy, which sees every request first
+func withStubProxy(proxy func(jenkins http.Handler) http.Handler) jenkinsStubOption {
+	return func(s *jenkinsStubSetup) {
+		s.handler = proxy(s.handler)
+	}
+}
+
+// newJenkinsStub starts a stand-in for a Jenkins controller. It serves the endpoints
+// the provider needs to connect, and hands the scripts to the given handler.
+func newJenkinsStub(t *testing.T, scriptHandler http.HandlerFunc, options ...jenkinsStubOption) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Jenkins", "2.263.1")
+		w.Write([]byte(`{"mode": "NORMAL", "nodeName": ""}`))
+	})
+	mux.HandleFunc("/pluginManager/api/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Jenkins", "2.263.1")
+		w.Write([]byte(`{"plugins": [
+			{"shortName": "mailer", "version": "1.32", "active": true, "enabled": true},
+			{"shortName": "matrix-auth", "version": "2.6.4", "active": true, "enabled": true},
+			{"shortName": "configuration-as-code", "version": "1.47", "active": true, "enabled": true}
+		]}`))
+	})
+	mux.HandleFunc("/scriptText", scriptHandler)
+
+	setup := &jenkinsStubSetup{mux: mux, handler: mux}
+	for _, option := range options {
+		option(setup)
+	}
+
+	server := httptest.NewServer(setup.handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// countScripts counts the scripts handed to the handler
+func countScripts(calls *int32, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		handler(w, r)
+	}
+}
+
+// testClientOption adjusts the configuration of a test client
+type testClientOption func(c *Config)
+
+// withServerPath serves Jenkins under a context path of the stand-in
+func withServerPath(path string) testClientOption {
+	return func(c *Config) {
+		c.ServerURL += path
+	}
+}
+
+// withBatching batches the scripts run within the window
+func withBatching(window time.Duration, maxSize int) testClientOption {
+	return func(c *Config) {
+		c.BatchWindow = window
+		c.BatchMaxSize = maxSize
+	}
+}
+
+// withCredentialCommand authenticates with the token printed by the command instead of a password
+func withCredentialCommand(command []string) testClientOption {
+	return func(c *Config) {
+		c.Username = ""
+		c.Password = ""
+		c.CredentialCommand = command
+	}
+}
+
+// newTestClient returns a client of the stand-in, retrying without waiting.
+// The stand-in is nil for the transports not using the web interface.
+func newTestClient(t *testing.T, server *httptest.Server, options ...testClientOption) *jenkinsAdapter {
+	config := &Config{
+		Username:     "admin",
+		Password:     "adminpwd",
+		MaxRetries:   3,
+		RetryWaitMin: time.Millisecond,
+		RetryWaitMax: 5 * time.Millisecond,
+	}
+	if server != nil {
+		config.ServerURL = server.URL
+	}
+	for _, option := range options {
+		option(config)
+	}
+
+	client, err := newJenkinsClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+var (
+	stubScriptName = regexp.MustCompile(`script=([a-z_]+)`)
+	stubUsername   = regexp.MustCompile(`(?:getUser|createAccount)\('([^']*)'`)
+)
+
+// localUsersStub stands in for the local user database of Jenkins. It answers the scripts
+// by the name of their header, and resolves user IDs case-insensitively like Jenkins.
+type localUsersStub struct {
+	mu            sync.Mutex
+	users         []string
+	current       string
+	seedsDisabled bool
+	scripts       []string
+}
+
+func (s *localUsersStub) handle(w http.ResponseWriter, r *http.Request) {
+	script := r.FormValue("script")
+	name := ""
+	if match := stubScriptName.FindStringSubmatch(script); match != nil {
+		name = match[1]
+	}
+	username := ""
+	if match := stubUsername.FindStringSubmatch(script); match != nil {
+		username = match[1]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts = append(s.scripts, name)
+
+	index := -1
+	for i, user := range s.users {
+		if strings.EqualFold(user, username) {
+			index = i
+		}
+	}
+
+	response := map[string]interface{}{"error": false, "msg": "", "data": map[string]interface{}{}}
+	notFound := map[string]interface{}{"error": true, "code": codeNotFound, "msg": "User " + username + " does not exist", "data": map[string]interface{}{}}
+	switch name {
+	case "get_local_users":
+		users := []map[string]string{}
+		for _, user := range s.users {
+			users = append(users, map[string]string{"username": user})
+		}
+		response["data"] = users
+	case "get_current_user":
+		response["data"] = map[string]string{"username": s.current}
+	case "get_local_user":
+		if index < 0 {
+			response = notFound
+		} else {
+			response["data"] = map[string]string{"username": s.users[index]}
+		}
+	case "create_local_user":
+		if index < 0 {
+			s.users = append(s.users, username)
+		}
+	case "delete_local_user":
+		if index < 0 {
+			response = notFound
+		} else {
+			s.users = append(s.users[:index], s.users[index+1:]...)
+		}
+	case "update_local_user_properties":
+	case "renew_local_user_seed":
+		if index < 0 {
+			response = notFound
+		} else {
+			response["data"] = map[string]bool{"renewed": !s.seedsDisabled}
+		}
+	default:
+		http.Error(w, "unexpected script "+name, http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// ran returns the names of the scripts run, in order
+func (s *localUsersStub) ran() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.scripts...)
+}
+
+// remaining returns the users left in the stand-in
+func (s *localUsersStub) remaining() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.users...)
+}
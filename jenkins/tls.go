@@ -0,0 +1,153 @@
+package jenkins
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// isInlinePEM tells whether a certificate or key attribute holds PEM content rather than a path
+func isInlinePEM(value string) bool {
+	return strings.Contains(value, "-----BEGIN ")
+}
+
+// readPEM returns the PEM content of an attribute given either inline or as a path
+func readPEM(value string) ([]byte, error) {
+	if isInlinePEM(value) {
+		return []byte(value), nil
+	}
+	return ioutil.ReadFile(value)
+}
+
+// loadClientCertificate loads the key pair used to authenticate to Jenkins with mutual TLS
+func loadClientCertificate(certValue string, keyValue string) (tls.Certificate, error) {
+	if certValue == "" || keyValue == "" {
+		return tls.Certificate{}, fmt.Errorf("client_cert and client_key must be set together")
+	}
+
+	cert, err := readPEM(certValue)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("Unable to read client certificate: %v", err)
+	}
+
+	key, err := readPEM(keyValue)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("Unable to read client key: %v", err)
+	}
+
+	keyPair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("Invalid client certificate and key pair: %v", err)
+	}
+
+	return keyPair, nil
+}
+
+// appendCertificates adds the certificates of PEM content to the pool. Every PEM block must be
+// a valid certificate, the number of certificates added is returned.
+func appendCertificates(pool *x509.CertPool, content []byte, source string) (int, error) {
+	count := 0
+	for block := 1; ; block++ {
+		var pemBlock *pem.Block
+		pemBlock, content = pem.Decode(content)
+		if pemBlock == nil {
+			return count, nil
+		}
+
+		if pemBlock.Type != "CERTIFICATE" {
+			return count, fmt.Errorf("Invalid certificate in %s: block %d is a %s, not a CERTIFICATE", source, block, pemBlock.Type)
+		}
+		cert, err := x509.ParseCertificate(pemBlock.Bytes)
+		if err != nil {
+			return count, fmt.Errorf("Invalid certificate in %s: block %d: %v", source, block, err)
+		}
+
+		pool.AddCert(cert)
+		count++
+	}
+}
+
+// loadCACertificates adds the CA certificates to the system ones. The certificates are given
+// inline, or as the path to a bundle file or to a directory of certificate files.
+func loadCACertificates(value string) (*x509.CertPool, error) {
+	rootCAs, _ := x509.SystemCertPool()
+	if rootCAs == nil {
+		rootCAs = x509.NewCertPool()
+	}
+
+	if value == "" {
+		return rootCAs, nil
+	}
+
+	if isInlinePEM(value) {
+		count, err := appendCertificates(rootCAs, []byte(value), "inline ca_cert")
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("No valid certificate found in inline ca_cert")
+		}
+		return rootCAs, nil
+	}
+
+	info, err := os.Stat(value)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open certificate file %s: %v", value, err)
+	}
+
+	if !info.IsDir() {
+		certs, err := ioutil.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read certificate file %s: %v", value, err)
+		}
+		count, err := appendCertificates(rootCAs, certs, value)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("No valid certificate found in %s", value)
+		}
+		return rootCAs, nil
+	}
+
+	files, err := ioutil.ReadDir(value)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read certificate directory %s: %v", value, err)
+	}
+
+	// Other files without PEM content may live next to the certificates, only an empty directory is an error
+	appended := 0
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(value, file.Name())
+		certs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read certificate file %s: %v", path, err)
+		}
+		count, err := appendCertificates(rootCAs, certs, path)
+		if err != nil {
+			return nil, err
+		}
+		appended += count
+	}
+
+	if appended == 0 {
+		return nil, fmt.Errorf("No valid certificate found in directory %s", value)
+	}
+
+	return rootCAs, nil
+}
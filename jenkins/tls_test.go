@@ -0,0 +1,162 @@
+package jenkins
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate and its private key, PEM encoded
+func testCertificate(t *testing.T, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		DNSNames:              []string{commonName},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %v", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Unable to marshal key: %v", err)
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return string(cert), string(keyPem)
+}
+
+func TestLoadClientCertificate(t *testing.T) {
+	cert, key := testCertificate(t, "terraform")
+	_, otherKey := testCertificate(t, "other")
+
+	if _, err := loadClientCertificate(cert, key); err != nil {
+		t.Errorf("Expected inline key pair to load, got %v", err)
+	}
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.crt")
+	keyPath := filepath.Join(dir, "client.key")
+	if err := ioutil.WriteFile(certPath, []byte(cert), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyPath, []byte(key), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadClientCertificate(certPath, keyPath); err != nil {
+		t.Errorf("Expected key pair from files to load, got %v", err)
+	}
+
+	if _, err := loadClientCertificate(cert, otherKey); err == nil {
+		t.Errorf("Expected mismatched key pair to fail")
+	}
+	if _, err := loadClientCertificate(cert, ""); err == nil {
+		t.Errorf("Expected missing key to fail")
+	}
+	if _, err := loadClientCertificate(filepath.Join(dir, "missing.crt"), keyPath); err == nil {
+		t.Errorf("Expected unreadable certificate to fail")
+	}
+}
+
+func TestLoadCACertificates(t *testing.T) {
+	first, _ := testCertificate(t, "first")
+	second, _ := testCertificate(t, "second")
+
+	if _, err := loadCACertificates(""); err != nil {
+		t.Errorf("Expected system certificates only, got %v", err)
+	}
+	if _, err := loadCACertificates(first + second); err != nil {
+		t.Errorf("Expected inline bundle to load, got %v", err)
+	}
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "bundle.pem")
+	if err := ioutil.WriteFile(bundle, []byte(first+second), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCACertificates(bundle); err != nil {
+		t.Errorf("Expected bundle file to load, got %v", err)
+	}
+
+	certDir := filepath.Join(dir, "certs")
+	if err := os.Mkdir(certDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"first.crt": first, "second.crt": second, "README": "not a certificate"} {
+		if err := ioutil.WriteFile(filepath.Join(certDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := loadCACertificates(certDir); err != nil {
+		t.Errorf("Expected certificate directory to load, got %v", err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.pem")
+	if err := ioutil.WriteFile(invalid, []byte("certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCACertificates(invalid); err == nil {
+		t.Errorf("Expected file without certificate to fail")
+	}
+	if _, err := loadCACertificates(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Errorf("Expected missing file to fail")
+	}
+	if _, err := loadCACertificates(t.TempDir()); err == nil {
+		t.Errorf("Expected empty directory to fail")
+	}
+}
+
+func TestLoadCACertificates_invalidBlock(t *testing.T) {
+	valid, _ := testCertificate(t, "valid")
+	invalid := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("not a certificate")}))
+
+	if _, err := loadCACertificates(valid + invalid); err == nil || !strings.Contains(err.Error(), "inline ca_cert: block 2") {
+		t.Errorf("Expected the invalid inline block to be reported, got %v", err)
+	}
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "bundle.pem")
+	if err := ioutil.WriteFile(bundle, []byte(valid+invalid), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCACertificates(bundle); err == nil || !strings.Contains(err.Error(), bundle+": block 2") {
+		t.Errorf("Expected the invalid block of the bundle to be reported, got %v", err)
+	}
+
+	certDir := filepath.Join(dir, "certs")
+	if err := os.Mkdir(certDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"valid.crt": valid, "invalid.crt": invalid} {
+		if err := ioutil.WriteFile(filepath.Join(certDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	invalidPath := filepath.Join(certDir, "invalid.crt")
+	if _, err := loadCACertificates(certDir); err == nil || !strings.Contains(err.Error(), invalidPath+": block 1") {
+		t.Errorf("Expected the invalid certificate of the directory to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+package jenkins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	jenkins "github.com/bndr/gojenkins"
+)
+
+const (
+	transportScript = "script"
+	transportJCasC  = "jcasc"
+	transportSSH    = "ssh"
+)
+
+// scriptTransport runs the rendered groovy scripts on Jenkins
+type scriptTransport interface {
+	// open checks the settings of the transport, then connects to Jenkins
+	open(ctx context.Context) error
+	// sendScript runs a single script and returns its raw outcome
+	sendScript(ctx context.Context, script string) (scriptResult, error)
+	// fetchCapabilities discovers the core version and the active plugins
+	fetchCapabilities(ctx context.Context) (jenkinsCapabilities, error)
+}
+
+// httpTransport runs the scripts through the script console of the web interface
+type httpTransport struct {
+	*jenkins.Jenkins
+	config *Config
+
+	// crumbs caches the CSRF protection crumbs by session cookie
+	crumbsMu sync.Mutex
+	crumbs   map[string]jenkinsCrumb
+}
+
+// jenkinsCrumb is the CSRF protection crumb issued by Jenkins, empty when it issues none
+type jenkinsCrumb struct {
+	field string
+	value string
+}
+
+func (t *httpTransport) open(ctx context.Context) error {
+	if t.config.ServerURL == "" {
+		return errServerURLMissing
+	}
+
+	if err := t.config.validate(); err != nil {
+		return err
+	}
+
+	if _, err := t.Init(); err != nil {
+		return fmt.Errorf("Unable to connect to Jenkins at %s: %v", t.config.ServerURL, err)
+	}
+
+	return nil
+}
+
+// fetchCapabilities lists the plugins, the core version comes with the response headers
+func (t *httpTransport) fetchCapabilities(ctx context.Context) (jenkinsCapabilities, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.Requester.Base+"/pluginManager/api/json?depth=1", nil)
+	if err != nil {
+		return jenkinsCapabilities{}, err
+	}
+
+	resp, err := t.Requester.Client.Do(req)
+	if err != nil {
+		return jenkinsCapabilities{}, fmt.Errorf("Error listing Jenkins plugins: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return jenkinsCapabilities{}, fmt.Errorf("Error listing Jenkins plugins, response code: %d", resp.StatusCode)
+	}
+
+	pluginList := struct {
+		Plugins []struct {
+			ShortName string `json:"shortName"`
+			Version   string `json:"version"`
+			Active    bool   `json:"active"`
+			Enabled   bool   `json:"enabled"`
+		} `json:"plugins"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&pluginList); err != nil {
+		return jenkinsCapabilities{}, fmt.Errorf("Unexpected response listing Jenkins plugins: %v", err)
+	}
+
+	capabilities := jenkinsCapabilities{
+		Version: resp.Header.Get("X-Jenkins"),
+		Plugins: map[string]string{},
+	}
+	if capabilities.Version == "" {
+		capabilities.Version = t.Version
+	}
+	for _, plugin := range pluginList.Plugins {
+		if plugin.Active && plugin.Enabled {
+			capabilities.Plugins[plugin.ShortName] = plugin.Version
+		}
+	}
+
+	return capabilities, nil
+}
+
+// sendScript makes a single call to the Jenkins script console
+func (t *httpTransport) sendScript(ctx context.Context, script string) (scriptResult, error) {
+	form := url.Values{}
+	form.Set("script", script)
+
+	resp, err := t.post(ctx, "/scriptText", "application/x-www-form-urlencoded", []byte(form.Encode()))
+	if err != nil {
+		return scriptResult{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return scriptResult{}, err
+	}
+
+	return scriptResult{statusCode: resp.StatusCode, body: body}, nil
+}
+
+// maxRedirects bounds the redirects followed by a request, like the default of the HTTP client
+const maxRedirects = 10
+
+// redirectError is a redirect the provider refuses to follow. It is not retried.
+type redirectError struct {
+	message string
+}
+
+func (e *redirectError) Error() string {
+	return e.message
+}
+
+// checkRedirect lets the HTTP client follow the redirects of reads only. It would turn
+// a POST into a GET when redirected, dropping the script, so post follows them instead.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if via[0].Method == http.MethodPost {
+		return http.ErrUseLastResponse
+	}
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return nil
+}
+
+// post sends the body to the path of Jenkins with a crumb, following the redirects of
+// the reverse proxies, e.g. to https or to the context path of Jenkins, with the same body.
+// The body is never sent to another host, nor downgraded from https.
+func (t *httpTransport) post(ctx context.Context, path string, contentType string, body []byte) (*http.Response, error) {
+	target := t.Requester.Base + path
+	crumbRefetched := false
+	for redirects := 0; ; redirects++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		if err := t.setCrumb(ctx, req); err != nil {
+			return nil, err
+		}
+
+		resp, err := t.Requester.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		// The cached crumb is refetched once when its session has expired meanwhile
+		if rejected, err := crumbRejected(resp); err != nil {
+			return nil, err
+		} else if rejected && !crumbRefetched {
+			crumbRefetched = true
+			t.forgetCrumb(req.URL)
+			redirects--
+			continue
+		}
+
+		switch resp.StatusCode {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		location, err := resp.Location()
+		if err != nil {
+			return nil, &redirectError{fmt.Sprintf("Jenkins redirected %s without a valid location: %v", path, err)}
+		}
+		switch {
+		case redirects+1 >= maxRedirects:
+			return nil, &redirectError{fmt.Sprintf("Jenkins redirected %s more than %d times", path, maxRedirects)}
+		case location.Host != req.URL.Host:
+			return nil, &redirectError{fmt.Sprintf("Jenkins redirected %s to another host, %s, set server_url to the URL of Jenkins", path, location.Host)}
+		case req.URL.Scheme == "https" && location.Scheme != "https":
+			return nil, &redirectError{fmt.Sprintf("Jenkins redirected %s from https to %s", path, location.Scheme)}
+		}
+
+		log.Printf("[DEBUG] Jenkins redirected %s to %s", path, location.Redacted())
+		target = location.String()
+	}
+}
+
+// setCrumb adds the CSRF protection crumb to a request, when Jenkins issues one.
+// The crumb is bound to the session, its cookie is kept by the cookie jar of the client,
+// so it is only fetched again for another session or once Jenkins rejected it.
+func (t *httpTransport) setCrumb(ctx context.Context, req *http.Request) error {
+	crumb, ok := t.cachedCrumb(req.URL)
+	if !ok {
+		var err error
+		if crumb, err = t.fetchCrumb(ctx); err != nil {
+			return err
+		}
+
+		// The crumb issuer may start the session, so the crumb is cached under its cookie
+		t.crumbsMu.Lock()
+		if t.crumbs == nil {
+			t.crumbs = map[string]jenkinsCrumb{}
+		}
+		t.crumbs[t.sessionKey(req.URL)] = crumb
+		t.crumbsMu.Unlock()
+	}
+
+	if crumb.field != "" {
+		req.Header.Set(crumb.field, crumb.value)
+	}
+	return nil
+}
+
+// fetchCrumb asks Jenkins for a crumb, none is issued when CSRF protection is disabled
+func (t *httpTransport) fetchCrumb(ctx context.Context) (jenkinsCrumb, error) {
+	crumbReq, err := http.NewRequestWithContext(ctx, http.MethodGet, t.Requester.Base+"/crumbIssuer/api/json", nil)
+	if err != nil {
+		return jenkinsCrumb{}, err
+	}
+
+	resp, err := t.Requester.Client.Do(crumbReq)
+	if err != nil {
+		return jenkinsCrumb{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return jenkinsCrumb{}, nil
+	}
+
+	crumb := map[string]string{}
+	if err := json.NewDecoder(resp.Body).Decode(&crumb); err != nil || crumb["crumbRequestField"] == "" {
+		return jenkinsCrumb{}, nil
+	}
+
+	return jenkinsCrumb{field: crumb["crumbRequestField"], value: crumb["crumb"]}, nil
+}
+
+func (t *httpTransport) cachedCrumb(target *url.URL) (jenkinsCrumb, bool) {
+	t.crumbsMu.Lock()
+	defer t.crumbsMu.Unlock()
+	crumb, ok := t.crumbs[t.sessionKey(target)]
+	return crumb, ok
+}
+
+func (t *httpTransport) forgetCrumb(target *url.URL) {
+	t.crumbsMu.Lock()
+	defer t.crumbsMu.Unlock()
+	delete(t.crumbs, t.sessionKey(target))
+}
+
+// sessionKey identifies the session of the requests to the target by the cookies sent with them
+func (t *httpTransport) sessionKey(target *url.URL) string {
+	if t.Requester.Client.Jar == nil {
+		return ""
+	}
+
+	cookies := []string{}
+	for _, cookie := range t.Requester.Client.Jar.Cookies(target) {
+		cookies = append(cookies, cookie.String())
+	}
+	return strings.Join(cookies, "; ")
+}
+
+// crumbRejected tells whether Jenkins rejected the crumb of a request. The body of the other
+// 403 responses is kept for the caller.
+func crumbRejected(resp *http.Response) (bool, error) {
+	if resp.StatusCode != http.StatusForbidden {
+		return false, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return bytes.Contains(body, []byte("No valid crumb was included in the request")), nil
+}
@@ -0,0 +1,65 @@
+package jenkins
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// localUsernamePattern is the default value of HudsonPrivateSecurityRealm.ID_REGEX
+var localUsernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// reservedUsernames cannot be used as user IDs, Jenkins compares them case-insensitively
+var reservedUsernames = []string{"anonymous", "system", "unknown"}
+
+// validateLocalUsername checks a username against the rules Jenkins applies to local user IDs
+func validateLocalUsername(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+
+	if !localUsernamePattern.MatchString(v) {
+		return nil, []error{fmt.Errorf("%s %q may only contain alphanumeric characters, underscores and dashes", k, v)}
+	}
+
+	for _, reserved := range reservedUsernames {
+		if strings.EqualFold(v, reserved) {
+			return nil, []error{fmt.Errorf("%s %q is reserved by Jenkins", k, v)}
+		}
+	}
+
+	return nil, nil
+}
+
+// validateEmail checks that an email address is a bare RFC 5322 address, without display name
+func validateEmail(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+
+	address, err := mail.ParseAddress(v)
+	if err != nil || address.Address != v {
+		return nil, []error{fmt.Errorf("%s %q is not a valid email address", k, v)}
+	}
+
+	return nil, nil
+}
+
+// validateDuration checks that a string is a positive Go duration, e.g. 30s or 5m
+func validateDuration(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+
+	duration, err := time.ParseDuration(v)
+	if err != nil || duration < 0 {
+		return nil, []error{fmt.Errorf("%s %q is not a valid duration, e.g. 30s or 5m", k, v)}
+	}
+
+	return nil, nil
+}
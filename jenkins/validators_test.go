@@ -0,0 +1,37 @@
+package jenkins
+
+import (
+	"testing"
+)
+
+func TestValidateLocalUsername(t *testing.T) {
+	valid := []string{"admin", "john-doe", "john_doe", "JohnDoe42"}
+	for _, v := range valid {
+		if _, errs := validateLocalUsername(v, "username"); len(errs) != 0 {
+			t.Errorf("Expected %q to be valid, got %v", v, errs)
+		}
+	}
+
+	invalid := []string{"", "john/doe", `john\doe`, "john doe", "john.doe", "SYSTEM", "Anonymous", "unknown"}
+	for _, v := range invalid {
+		if _, errs := validateLocalUsername(v, "username"); len(errs) == 0 {
+			t.Errorf("Expected %q to be invalid", v)
+		}
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	valid := []string{"john@example.com", "john.doe+jenkins@example.co.uk"}
+	for _, v := range valid {
+		if _, errs := validateEmail(v, "email"); len(errs) != 0 {
+			t.Errorf("Expected %q to be valid, got %v", v, errs)
+		}
+	}
+
+	invalid := []string{"", "john", "john@", "John <john@example.com>", " john@example.com"}
+	for _, v := range invalid {
+		if _, errs := validateEmail(v, "email"); len(errs) == 0 {
+			t.Errorf("Expected %q to be invalid", v)
+		}
+	}
+}
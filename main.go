@@ -7,7 +7,12 @@ import (
 	"github.com/ringanta/terraform-provider-jenkins/jenkins"
 )
 
+// version is set when building a release
+var version = "dev"
+
 func main() {
+	jenkins.Version = version
+
 	plugin.Serve(&plugin.ServeOpts{
 		ProviderFunc: func() *schema.Provider {
 			return jenkins.Provider()